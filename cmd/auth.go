@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crud/internal/auth"
+	"crud/internal/config"
+	"time"
+)
+
+// newAuthenticator builds the verifiers of the config, or returns nil if
+// authentication is disabled. Client certificates are verified when the
+// server asks for them.
+func newAuthenticator(cfg config.AuthConfig, tlsCfg config.TLSConfig) (auth.Authenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var authn auth.Authenticator
+	if len(cfg.APIKeys) > 0 {
+		keys, err := auth.NewAPIKeys(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		authn = append(authn, keys)
+	}
+	if cfg.JWKSFile != "" {
+		jwt, err := auth.NewJWT(cfg.JWKSFile, cfg.JWTIssuer, cfg.JWTAudience, time.Duration(cfg.JWTLeeway))
+		if err != nil {
+			return nil, err
+		}
+		authn = append(authn, jwt)
+	}
+	if tlsCfg.Enabled && tlsCfg.ClientCAFile != "" {
+		certs, err := auth.NewClientCerts(cfg.ClientCerts)
+		if err != nil {
+			return nil, err
+		}
+		authn = append(authn, certs)
+	}
+	return authn, nil
+}
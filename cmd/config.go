@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crud/internal/auth"
+	"crud/internal/config"
+	"crud/internal/http_server/handlers"
+	"crud/pkg/ratelimit"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const configUsage = `usage: crud config print [--redacted]
+  print  show the effective configuration as JSON
+         --redacted hides passwords and other secrets`
+
+// runConfig runs the config subcommand and returns the exit code.
+func runConfig(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "print" || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	if len(args) == 2 {
+		switch args[1] {
+		case "--redacted", "-redacted":
+			cfg = cfg.Redacted()
+		default:
+			fmt.Fprintln(os.Stderr, configUsage)
+			return 2
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	// URIs carry query strings, keep their & readable.
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "config print: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// checkConfig parses the entries that config leaves to other packages and
+// reports all problems at once, the way config.Validate does.
+func checkConfig(cfg *config.Config) error {
+	var errs config.ValidationError
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if cfg.Auth.Enabled {
+		for _, entry := range cfg.Auth.APIKeys {
+			if _, _, err := auth.ParseAPIKey(entry); err != nil {
+				add("auth.api_keys: %v", err)
+			}
+		}
+	}
+	for _, entry := range cfg.Auth.ClientCerts {
+		if _, err := auth.ParseClientCert(entry); err != nil {
+			add("auth.client_certs: %v", err)
+		}
+	}
+
+	if _, err := ratelimit.ParseLimit(cfg.RateLimit.PerIP); err != nil {
+		add("rate_limit.per_ip: %v", err)
+	}
+	if _, err := ratelimit.ParseLimit(cfg.RateLimit.Default); err != nil {
+		add("rate_limit.default: %v", err)
+	}
+	for _, entry := range cfg.RateLimit.Routes {
+		if _, err := handlers.ParseRouteLimit(entry); err != nil {
+			add("rate_limit.routes: %v", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
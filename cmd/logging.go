@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crud/internal/config"
+	"crud/pkg/logger"
+	"github.com/rs/zerolog"
+	"io"
+	"os"
+	"time"
+)
+
+// newLogWriter opens the log sinks of the config. The returned function
+// closes those that need it.
+func newLogWriter(cfg config.LogOutputConfig) (io.Writer, func(), error) {
+	var (
+		writers []io.Writer
+		closers []io.Closer
+	)
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+
+	for _, sink := range cfg.Sinks {
+		switch sink {
+		case config.SinkStdout:
+			writers = append(writers, os.Stdout)
+		case config.SinkConsole:
+			writers = append(writers, zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+		case config.SinkFile:
+			file, err := logger.NewRotatingFile(cfg.File, logger.RotateOptions{
+				MaxSize:    int64(cfg.FileMaxSizeMB) << 20,
+				Every:      time.Duration(cfg.FileRotateEvery),
+				MaxBackups: cfg.FileMaxBackups,
+				MaxAge:     time.Duration(cfg.FileMaxAge),
+			})
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			writers = append(writers, file)
+			closers = append(closers, file)
+		case config.SinkSyslog:
+			syslog, err := logger.NewSyslog(cfg.SyslogSocket, cfg.SyslogTag)
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			writers = append(writers, syslog)
+			closers = append(closers, syslog)
+		}
+	}
+
+	if len(writers) == 1 {
+		return writers[0], closeAll, nil
+	}
+	return zerolog.MultiLevelWriter(writers...), closeAll, nil
+}
+
+// redaction converts the log_redaction config for logger.SetRedaction.
+func redaction(c config.LogRedactionConfig) logger.Redaction {
+	return logger.Redaction{
+		Allow:     c.Allow,
+		Deny:      c.Deny,
+		Mode:      c.Mode,
+		MaxLength: c.MaxLength,
+		HashKey:   c.HashKey,
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/storage"
+	"crud/internal/storage/migrate"
+	"fmt"
+	"github.com/rs/zerolog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+const migrateUsage = `usage: crud migrate up [N] | down [N] | status
+  up      apply N pending migrations, all of them by default
+  down    revert the last N applied migrations, 1 by default
+  status  list applied and pending migrations`
+
+// runMigrate runs the migrate subcommand and returns the exit code.
+func runMigrate(cfg *config.Config, lgr zerolog.Logger, args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	n := 0
+	if args[0] == "down" {
+		n = 1
+	}
+	if len(args) == 2 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 1 || args[0] == "status" {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	migrator, closeDB := storage.NewMigrator(config.NewSnapshot(cfg), lgr)
+	defer closeDB()
+	if migrator == nil {
+		fmt.Printf("the %s database has no schema to migrate\n", cfg.Database.Name)
+		return 0
+	}
+
+	var (
+		steps []migrate.Step
+		err   error
+	)
+	switch args[0] {
+	case "up":
+		steps, err = migrator.Up(ctx, n)
+		for _, step := range steps {
+			fmt.Printf("applied  %s\n", step)
+		}
+	case "down":
+		steps, err = migrator.Down(ctx, n)
+		for _, step := range steps {
+			fmt.Printf("reverted %s\n", step)
+		}
+	case "status":
+		err = printStatus(ctx, migrator)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", args[0], err)
+		return 1
+	}
+
+	return 0
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	s, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("current version %d, latest %d\n", s.Current, s.Latest)
+	for _, step := range s.Applied {
+		fmt.Printf("applied  %s\n", step)
+	}
+	for _, step := range s.Pending {
+		fmt.Printf("pending  %s\n", step)
+	}
+	for _, version := range s.Unknown {
+		fmt.Printf("unknown  %04d (applied by a newer build)\n", version)
+	}
+
+	return nil
+}
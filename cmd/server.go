@@ -3,11 +3,18 @@ package main
 import (
 	"context"
 	"crud/internal/config"
+	"crud/internal/debug_server"
 	"crud/internal/http_server"
 	"crud/internal/http_server/handlers"
 	"crud/internal/storage"
 	"crud/pkg/logger"
+	"crud/pkg/metrics"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rs/zerolog"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -18,25 +25,82 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	cfg := config.NewConfig()
+	cfg, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err == nil {
+		err = checkConfig(cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfig(cfg, args[1:]))
+	}
 
-	lgr, err := logger.NewLogger(os.Stdout, cfg.LogLevel)
+	logWriter, closeLogs, err := newLogWriter(cfg.LogOutput)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	defer closeLogs()
+
+	lgr, err := logger.NewLogger(logWriter, cfg.LogLevel)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err = logger.SetRedaction(redaction(cfg.LogRedaction)); err != nil {
+		log.Fatalln(err)
+	}
 
 	lgr = lgr.With().
 		CallerWithSkipFrameCount(2).
 		Str("app", "crud").
 		Logger()
 
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(cfg, lgr, args[1:]))
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected migrate or config\n", args[0])
+		os.Exit(2)
+	}
+
 	shutdownCh := make(chan os.Signal, 1)
-	signal.Notify(shutdownCh, syscall.SIGKILL, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(shutdownCh, syscall.SIGKILL, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+
+	snapshot := config.NewSnapshot(cfg)
+
+	reg := metrics.NewRegistry()
 
-	stor := storage.NewStorage(cfg, lgr)
+	tracer, err := newTracer(cfg.Tracing, lgr)
+	if err != nil {
+		lgr.Fatal().Err(err).Msg("failed to create tracer")
+	}
+
+	authn, err := newAuthenticator(cfg.Auth, cfg.HttpServer.TLS)
+	if err != nil {
+		lgr.Fatal().Err(err).Msg("failed to set up authentication")
+	}
 
-	handler := handlers.NewHandler(cfg, lgr, stor)
-	httpServer, listenHTTPErr := http_server.NewServer(cfg, lgr, handler)
+	stor := storage.NewStorage(snapshot, lgr, reg, tracer)
+
+	handler := handlers.NewHandler(snapshot, lgr, stor, reg, tracer, authn)
+	httpServer, listenHTTPErr := http_server.NewServer(snapshot, lgr, handler)
+
+	// A nil channel never fires, so a disabled debug server is never waited on.
+	var (
+		debugServer    *debug_server.Server
+		listenDebugErr chan error
+	)
+	if cfg.DebugServer.Enabled {
+		debugServer, listenDebugErr = debug_server.NewServer(snapshot, lgr, stor)
+	}
 
 mainLoop:
 	for {
@@ -50,18 +114,69 @@ mainLoop:
 				shutdownCh <- syscall.SIGTERM
 			}
 
+		case err = <-listenDebugErr:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				lgr.Error().Err(err).Msg("debug server error")
+				shutdownCh <- syscall.SIGTERM
+			}
+
+		case <-reloadCh:
+			reloadConfig(snapshot, handler, lgr)
+
 		case sig := <-shutdownCh:
 			lgr.Info().Msgf("shutdown signal received: %s", sig.String())
 			ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
 
+			handler.Drain()
+			if delay := snapshot.Load().HttpServer.DrainDelay; delay > 0 {
+				lgr.Info().Msgf("draining for %s", delay)
+				time.Sleep(time.Duration(delay))
+			}
+
 			if err = httpServer.Shutdown(); err != nil {
 				lgr.Error().Err(err).Msg("shutdown http server error")
 			}
+			if debugServer != nil {
+				if err = debugServer.Shutdown(); err != nil {
+					lgr.Error().Err(err).Msg("shutdown debug server error")
+				}
+			}
 
 			stor.Shutdown()
 
+			if err = tracer.Shutdown(ctx); err != nil {
+				lgr.Error().Err(err).Msg("shutdown tracer error")
+			}
+
 			lgr.Info().Msg("server loop stopped")
 			cancel()
 		}
 	}
 }
+
+// reloadConfig loads the configuration again the way main did and applies
+// what can change live, including the log level over one set through the
+// admin endpoint. A config that fails to load is ignored.
+func reloadConfig(snapshot *config.Snapshot, handler *handlers.Handler, lgr zerolog.Logger) {
+	next, _, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err == nil {
+		err = checkConfig(next)
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("config reload failed, keeping the current config")
+		return
+	}
+
+	applied, restart := snapshot.Apply(next)
+	if err = handler.ResetLogLevel(); err != nil {
+		lgr.Error().Err(err).Msg("failed to set log level")
+	}
+	if err = logger.SetRedaction(redaction(snapshot.Load().LogRedaction)); err != nil {
+		lgr.Error().Err(err).Msg("failed to set log redaction")
+	}
+
+	lgr.Info().Strs("applied", applied).Msg("config reloaded")
+	if len(restart) > 0 {
+		lgr.Warn().Strs("fields", restart).Msg("config changes need a restart to take effect")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crud/internal/config"
+	"crud/internal/requestid"
+	"crud/pkg/tracing"
+	"github.com/rs/zerolog"
+	"os"
+	"strings"
+)
+
+// newTracer builds the tracer and its exporter from the config.
+func newTracer(cfg config.TracingConfig, lgr zerolog.Logger) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.Exporter {
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		fileExporter, err := tracing.NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	case "otlp":
+		headers := make(map[string]string, len(cfg.OTLPHeaders))
+		for _, header := range cfg.OTLPHeaders {
+			name, value, _ := strings.Cut(header, "=")
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		exporter = tracing.NewOTLPExporter(cfg.OTLPEndpoint, headers, &requestid.Transport{})
+	}
+
+	lgr = lgr.With().Str("component", "tracing").Logger()
+	return tracing.NewTracer(cfg.ServiceName, exporter, cfg.SampleRatio, func(err error) {
+		lgr.Warn().Err(err).Msg("failed to export spans")
+	}), nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIKeyHeader carries the API key of a request.
+const APIKeyHeader = "X-API-Key"
+
+type apiKey struct {
+	principal Principal
+	hash      []byte
+}
+
+// APIKeys verifies keys against their SHA-256 hashes, so that the config
+// holds no usable key.
+type APIKeys struct {
+	keys []apiKey
+}
+
+// NewAPIKeys takes entries parsed by ParseAPIKey.
+func NewAPIKeys(entries []string) (*APIKeys, error) {
+	a := new(APIKeys)
+	for _, entry := range entries {
+		principal, hash, err := ParseAPIKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = append(a.keys, apiKey{principal: principal, hash: hash})
+	}
+	return a, nil
+}
+
+// ParseAPIKey reads a "name:hash[:role[:author_id]]" entry of the config,
+// hash being the hex SHA-256 of the key, e.g. from
+// "printf %s KEY | sha256sum". The name is the subject of the principal.
+func ParseAPIKey(entry string) (Principal, []byte, error) {
+	parts := strings.Split(entry, ":")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] == "" {
+		// Not echoed: it may be a key pasted by mistake.
+		return Principal{}, nil, errors.New("an api key is not name:sha256[:role[:author_id]]")
+	}
+
+	p := Principal{Subject: parts[0], Method: MethodAPIKey}
+	hash, err := hex.DecodeString(parts[1])
+	if err != nil || len(hash) != sha256.Size {
+		return Principal{}, nil, fmt.Errorf("api key %q: hash is not a hex SHA-256", p.Subject)
+	}
+	if len(parts) > 2 {
+		p.Role = parts[2]
+	}
+	if len(parts) > 3 {
+		p.AuthorId, err = strconv.ParseUint(parts[3], 10, 64)
+		if err != nil {
+			return Principal{}, nil, fmt.Errorf("api key %q: bad author id %q", p.Subject, parts[3])
+		}
+	}
+	if err = checkRole(p.Role, p.AuthorId); err != nil {
+		return Principal{}, nil, fmt.Errorf("api key %q: %w", p.Subject, err)
+	}
+	return p, hash, nil
+}
+
+func (a *APIKeys) Verify(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	// Every key is compared, so that the time taken tells nothing.
+	var found *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], a.keys[i].hash) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: unknown api key", ErrInvalid)
+	}
+	p := found.principal
+	return &p, nil
+}
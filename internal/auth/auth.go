@@ -0,0 +1,114 @@
+// Package auth finds out who sent a request, from an API key, a JWT bearer
+// token or a TLS client certificate.
+package auth
+
+import (
+	"context"
+	"crud/internal/constants"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/http"
+)
+
+var (
+	// ErrNoCredentials is returned when a request carries no credentials
+	// of the kind a Verifier handles.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalid is wrapped by the errors of credentials that were sent but
+	// are not accepted.
+	ErrInvalid = errors.New("invalid credentials")
+)
+
+// Authentication methods, as Principal.Method reports them.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodMTLS   = "mtls"
+)
+
+// Roles a principal may have. Without one it can only read.
+const (
+	// RoleAdmin may do anything.
+	RoleAdmin = "admin"
+	// RoleEditor may write every post and author, but not delete authors.
+	RoleEditor = "editor"
+	// RoleAuthor may write only its own posts and author.
+	RoleAuthor = "author"
+)
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	// Subject is the name of the API key, the sub claim of the token or the
+	// common name of the client certificate.
+	Subject string
+	Method  string
+	Role    string
+	// AuthorId is the author a RoleAuthor principal acts as.
+	AuthorId uint64
+}
+
+// checkRole tells whether role and authorId go together.
+func checkRole(role string, authorId uint64) error {
+	switch role {
+	case "", RoleAdmin, RoleEditor:
+		if authorId != 0 {
+			return fmt.Errorf("author id %d given to role %q", authorId, role)
+		}
+	case RoleAuthor:
+		if authorId == 0 {
+			return errors.New("role author without an author id")
+		}
+	default:
+		return fmt.Errorf("unknown role %q", role)
+	}
+	return nil
+}
+
+// MarshalZerologObject adds the principal to a log line. A nil Principal
+// adds nothing.
+func (p *Principal) MarshalZerologObject(e *zerolog.Event) {
+	if p == nil {
+		return
+	}
+	e.Str(constants.PrincipalKey, p.Subject).Str("auth_method", p.Method)
+	if p.Role != "" {
+		e.Str("role", p.Role)
+	}
+	if p.AuthorId != 0 {
+		e.Uint64("principal_author_id", p.AuthorId)
+	}
+}
+
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(constants.PrincipalKey).(*Principal)
+	return p
+}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, constants.PrincipalKey, p)
+}
+
+// Verifier checks one kind of credentials.
+type Verifier interface {
+	// Verify returns the principal the credentials of r belong to,
+	// ErrNoCredentials if r has none of this kind, or an error wrapping
+	// ErrInvalid.
+	Verify(r *http.Request) (*Principal, error)
+}
+
+// Authenticator tries its verifiers in turn.
+type Authenticator []Verifier
+
+// Authenticate returns the principal of the first verifier that found
+// credentials in r, or ErrNoCredentials.
+func (a Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	for _, v := range a {
+		p, err := v.Verify(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
@@ -0,0 +1,255 @@
+package auth_test
+
+import (
+	"crud/internal/auth"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+func TestAPIKeys(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	keys, err := auth.NewAPIKeys([]string{"ci:" + hex.EncodeToString(sum[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	if _, err = keys.Verify(r); !errors.Is(err, auth.ErrNoCredentials) {
+		t.Errorf("got %v without a key", err)
+	}
+
+	r.Header.Set(auth.APIKeyHeader, "s3cret")
+	p, err := keys.Verify(r)
+	if err != nil || p.Subject != "ci" || p.Method != auth.MethodAPIKey {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	r.Header.Set(auth.APIKeyHeader, "guess")
+	if _, err = keys.Verify(r); !errors.Is(err, auth.ErrInvalid) {
+		t.Errorf("got %v with a wrong key", err)
+	}
+
+	keys, err = auth.NewAPIKeys([]string{"alice:" + hex.EncodeToString(sum[:]) + ":author:42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set(auth.APIKeyHeader, "s3cret")
+	if p, err = keys.Verify(r); err != nil || p.Role != auth.RoleAuthor || p.AuthorId != 42 {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	for _, entry := range []string{
+		"ci:not-a-hash",
+		"ci:" + hex.EncodeToString(sum[:]) + ":author",
+		"ci:" + hex.EncodeToString(sum[:]) + ":owner",
+	} {
+		if _, err = auth.NewAPIKeys([]string{entry}); err == nil {
+			t.Errorf("%q was accepted", entry)
+		}
+	}
+}
+
+func TestClientCerts(t *testing.T) {
+	certs, err := auth.NewClientCerts([]string{"svc:editor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	if _, err = certs.Verify(r); !errors.Is(err, auth.ErrNoCredentials) {
+		t.Errorf("got %v without tls", err)
+	}
+
+	verified := func(name string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	r.TLS = verified("svc")
+	if p, err := certs.Verify(r); err != nil || p.Subject != "svc" || p.Role != auth.RoleEditor || p.Method != auth.MethodMTLS {
+		t.Errorf("got %+v, %v", p, err)
+	}
+	r.TLS = verified("other")
+	if p, err := certs.Verify(r); err != nil || p.Subject != "other" || p.Role != "" {
+		t.Errorf("got %+v, %v, want an unlisted name without a role", p, err)
+	}
+	r.TLS = verified("")
+	if _, err = certs.Verify(r); !errors.Is(err, auth.ErrInvalid) {
+		t.Errorf("got %v without a common name", err)
+	}
+
+	for _, entry := range []string{"", "svc:owner", "svc:author", "svc:author:x"} {
+		if _, err = auth.NewClientCerts([]string{entry}); err == nil {
+			t.Errorf("%q was accepted", entry)
+		}
+	}
+}
+
+// testKeys signs tokens with one key of every supported type.
+type testKeys struct {
+	hmac    []byte
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) (testKeys, string) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := testKeys{hmac: []byte("an hmac secret of 32 bytes......"), rsa: rsaKey, ed25519: edPrivate}
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64.EncodeToString(keys.hmac)},
+		{"kty": "RSA", "kid": "rs", "n": b64.EncodeToString(rsaKey.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64.EncodeToString(edPublic)},
+		{"kty": "RSA", "kid": "enc", "use": "enc"},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return keys, path
+}
+
+func (k testKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+
+	var signature []byte
+	switch alg {
+	case auth.AlgHS256:
+		mac := hmac.New(sha256.New, k.hmac)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case auth.AlgRS256:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case auth.AlgEdDSA:
+		signature = ed25519.Sign(k.ed25519, []byte(signed))
+	}
+	return signed + "." + b64.EncodeToString(signature)
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss": "https://issuer",
+		"aud": []string{"other", "crud"},
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(c, name)
+			continue
+		}
+		c[name] = value
+	}
+	return c
+}
+
+func TestJWT(t *testing.T) {
+	keys, path := newTestKeys(t)
+	verifier, err := auth.NewJWT(path, "https://issuer", "crud", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(token string) (*auth.Principal, error) {
+		r := httptest.NewRequest("GET", "/posts", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return verifier.Verify(r)
+	}
+
+	for _, alg := range []struct{ name, kid string }{{auth.AlgHS256, "hs"}, {auth.AlgRS256, "rs"}, {auth.AlgEdDSA, ""}} {
+		p, err := verify(keys.sign(t, alg.name, alg.kid, claims(nil)))
+		if err != nil || p.Subject != "alice" || p.Method != auth.MethodJWT {
+			t.Errorf("%s: got %+v, %v", alg.name, p, err)
+		}
+	}
+
+	p, err := verify(keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"role": "author", "author_id": 42})))
+	if err != nil || p.Role != auth.RoleAuthor || p.AuthorId != 42 {
+		t.Errorf("got %+v, %v, want the role claims", p, err)
+	}
+
+	rejected := map[string]string{
+		"unknown role":  keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"role": "owner"})),
+		"no author id":  keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"role": "author"})),
+		"expired":       keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiry":     keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"exp": nil})),
+		"not yet valid": keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"issuer":        keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"iss": "https://evil"})),
+		"audience":      keys.sign(t, auth.AlgHS256, "hs", claims(map[string]interface{}{"aud": "other"})),
+		"wrong kid":     keys.sign(t, auth.AlgHS256, "rs", claims(nil)),
+		"alg none":      keys.sign(t, "none", "", claims(nil)),
+		"tampered":      keys.sign(t, auth.AlgEdDSA, "ed", claims(nil))[:10] + "x" + keys.sign(t, auth.AlgEdDSA, "ed", claims(nil))[11:],
+		"garbage":       "not.a.token",
+	}
+	for name, token := range rejected {
+		if _, err := verify(token); !errors.Is(err, auth.ErrInvalid) {
+			t.Errorf("%s: got %v, want ErrInvalid", name, err)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	if _, err = verifier.Verify(r); !errors.Is(err, auth.ErrNoCredentials) {
+		t.Errorf("got %v without a token", err)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	keys, _ := auth.NewAPIKeys([]string{"ci:" + hex.EncodeToString(sum[:])})
+	_, path := newTestKeys(t)
+	jwt, err := auth.NewJWT(path, "https://issuer", "crud", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authn := auth.Authenticator{keys, jwt}
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	if _, err = authn.Authenticate(r); !errors.Is(err, auth.ErrNoCredentials) {
+		t.Errorf("got %v without credentials", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer bad")
+	if _, err = authn.Authenticate(r); !errors.Is(err, auth.ErrInvalid) {
+		t.Errorf("got %v with a bad token", err)
+	}
+
+	r.Header.Set(auth.APIKeyHeader, "s3cret")
+	if p, err := authn.Authenticate(r); err != nil || p.Subject != "ci" {
+		t.Errorf("got %+v, %v, want the API key to be tried first", p, err)
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ClientCerts authenticates requests by the client certificate that the TLS
+// handshake verified, as its common name. Names listed in the config get
+// their role, others none.
+type ClientCerts struct {
+	principals map[string]Principal
+}
+
+// NewClientCerts takes entries parsed by ParseClientCert.
+func NewClientCerts(entries []string) (*ClientCerts, error) {
+	c := &ClientCerts{principals: make(map[string]Principal)}
+	for _, entry := range entries {
+		p, err := ParseClientCert(entry)
+		if err != nil {
+			return nil, err
+		}
+		c.principals[p.Subject] = p
+	}
+	return c, nil
+}
+
+// ParseClientCert reads a "common_name[:role[:author_id]]" entry of the
+// config.
+func ParseClientCert(entry string) (Principal, error) {
+	parts := strings.Split(entry, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return Principal{}, fmt.Errorf("client cert %q is not common_name[:role[:author_id]]", entry)
+	}
+
+	p := Principal{Subject: parts[0], Method: MethodMTLS}
+	if len(parts) > 1 {
+		p.Role = parts[1]
+	}
+	if len(parts) > 2 {
+		var err error
+		p.AuthorId, err = strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			return Principal{}, fmt.Errorf("client cert %q: bad author id %q", p.Subject, parts[2])
+		}
+	}
+	if err := checkRole(p.Role, p.AuthorId); err != nil {
+		return Principal{}, fmt.Errorf("client cert %q: %w", p.Subject, err)
+	}
+	return p, nil
+}
+
+func (c *ClientCerts) Verify(r *http.Request) (*Principal, error) {
+	// VerifiedChains is only set when the handshake checked the certificate
+	// against the client CA bundle.
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return nil, fmt.Errorf("%w: client certificate without a common name", ErrInvalid)
+	}
+	p, ok := c.principals[name]
+	if !ok {
+		p = Principal{Subject: name, Method: MethodMTLS}
+	}
+	return &p, nil
+}
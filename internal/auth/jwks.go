@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// minRSABits is the smallest RSA key accepted for RS256.
+const minRSABits = 2048
+
+// jwk is a key of a JWKS file, as RFC 7517 writes it.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// K is the secret of an "oct" key.
+	K string `json:"k"`
+	// N and E are the modulus and exponent of an "RSA" key.
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv and X are the curve and public key of an "OKP" key.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+// key is a parsed jwk. Its public key is a []byte secret for HS256, an
+// *rsa.PublicKey or an ed25519.PublicKey.
+type key struct {
+	id     string
+	alg    string
+	public interface{}
+}
+
+// loadJWKS reads the keys of a JWKS file. Keys not meant for signatures
+// are skipped.
+func loadJWKS(path string) ([]key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("jwks %s: %w", path, err)
+	}
+
+	var keys []key
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s: key %d (%q): %w", path, i, k.Kid, err)
+		}
+		keys = append(keys, key{id: k.Kid, alg: k.Alg, public: public})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks %s: no signature keys", path)
+	}
+	return keys, nil
+}
+
+func (k jwk) parse() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeSegment(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("bad k")
+		}
+		return secret, nil
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, errors.New("bad n")
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("bad e")
+		}
+		public := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key shorter than %d bits", minRSABits)
+		}
+		return public, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad x")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
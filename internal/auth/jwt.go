@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signature algorithms accepted in tokens.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// JWT verifies bearer tokens signed with a key of a JWKS file, issued by
+// issuer for audience and not expired.
+type JWT struct {
+	keys     []key
+	issuer   string
+	audience string
+	// leeway tolerates clocks a little apart.
+	leeway time.Duration
+}
+
+func NewJWT(jwksFile, issuer, audience string, leeway time.Duration) (*JWT, error) {
+	keys, err := loadJWKS(jwksFile)
+	if err != nil {
+		return nil, err
+	}
+	return &JWT{keys: keys, issuer: issuer, audience: audience, leeway: leeway}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type claims struct {
+	Issuer    string       `json:"iss"`
+	Subject   string       `json:"sub"`
+	Audience  audience     `json:"aud"`
+	ExpiresAt *numericDate `json:"exp"`
+	NotBefore *numericDate `json:"nbf"`
+	// Role and AuthorId are private claims naming the author a token was
+	// issued to, see Principal.
+	Role     string `json:"role"`
+	AuthorId uint64 `json:"author_id"`
+}
+
+// audience is the aud claim, a string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(b, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// numericDate is seconds since the epoch, possibly with a fraction.
+type numericDate float64
+
+func (d numericDate) Time() time.Time {
+	return time.Unix(0, int64(float64(d)*float64(time.Second)))
+}
+
+func (j *JWT) Verify(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token == auth || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	c, err := j.parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return &Principal{Subject: c.Subject, Method: MethodJWT, Role: c.Role, AuthorId: c.AuthorId}, nil
+}
+
+func (j *JWT) parse(token string) (*claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJSON(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if err = j.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	c := new(claims)
+	if err = decodeJSON(parts[1], c); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	if err = j.checkClaims(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// verifySignature tries the keys with the kid of the token, or all of them
+// if it has none. A key is only used with the algorithm of its type, so
+// that e.g. an RSA public key can't be taken as an HMAC secret.
+func (j *JWT) verifySignature(header jwtHeader, signed, signature []byte) error {
+	for _, k := range j.keys {
+		if header.Kid != "" && k.id != header.Kid {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+
+		var ok bool
+		switch public := k.public.(type) {
+		case []byte:
+			if header.Alg != AlgHS256 {
+				continue
+			}
+			mac := hmac.New(sha256.New, public)
+			mac.Write(signed)
+			ok = hmac.Equal(signature, mac.Sum(nil))
+		case *rsa.PublicKey:
+			if header.Alg != AlgRS256 {
+				continue
+			}
+			sum := sha256.Sum256(signed)
+			ok = rsa.VerifyPKCS1v15(public, crypto.SHA256, sum[:], signature) == nil
+		case ed25519.PublicKey:
+			if header.Alg != AlgEdDSA {
+				continue
+			}
+			ok = ed25519.Verify(public, signed, signature)
+		}
+		if ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("no key verifies the %s signature", header.Alg)
+}
+
+func (j *JWT) checkClaims(c *claims) error {
+	now := time.Now()
+
+	if c.Issuer != j.issuer {
+		return fmt.Errorf("issuer %q is not accepted", c.Issuer)
+	}
+	found := false
+	for _, aud := range c.Audience {
+		found = found || aud == j.audience
+	}
+	if !found {
+		return fmt.Errorf("audience %q is not accepted", c.Audience)
+	}
+	if c.ExpiresAt == nil {
+		return errors.New("no expiry")
+	}
+	if now.After(c.ExpiresAt.Time().Add(j.leeway)) {
+		return errors.New("expired")
+	}
+	if c.NotBefore != nil && now.Add(j.leeway).Before(c.NotBefore.Time()) {
+		return errors.New("not valid yet")
+	}
+	if c.Subject == "" {
+		return errors.New("no subject")
+	}
+	return checkRole(c.Role, c.AuthorId)
+}
+
+func decodeJSON(segment string, v interface{}) error {
+	b, err := decodeSegment(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
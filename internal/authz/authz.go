@@ -0,0 +1,214 @@
+// Package authz decides what the principal of a request may write. It wraps
+// the storage interfaces, so that every backend enforces the same policy.
+//
+// Without a principal, when authentication is disabled, everything is
+// allowed. Otherwise anyone may read, and writes depend on the role:
+//
+//   - admin may do anything;
+//   - editor may write every author and post, but not delete authors;
+//   - author may write its own author and posts, and can't give a post to
+//     another author;
+//   - no role can only read.
+package authz
+
+import (
+	"context"
+	"crud/internal/auth"
+	"crud/internal/entities"
+	"crud/internal/storage"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"fmt"
+)
+
+func forbidden(format string, args ...interface{}) error {
+	return errs.New(errs.ErrForbidden, fmt.Sprintf(format, args...))
+}
+
+// can returns the principal of ctx, or nil if there is none and everything
+// is allowed. It fails unless the principal has one of roles.
+func can(ctx context.Context, action string, roles ...string) (*auth.Principal, error) {
+	p := auth.FromContext(ctx)
+	if p == nil {
+		return nil, nil
+	}
+	for _, role := range roles {
+		if p.Role == role {
+			return p, nil
+		}
+	}
+	return nil, forbidden("%s may not %s", p.Subject, action)
+}
+
+// isAuthor tells whether p only acts as an author.
+func isAuthor(p *auth.Principal) bool {
+	return p != nil && p.Role == auth.RoleAuthor
+}
+
+// pin makes an owner check hold until the write: the write is made at the
+// version that was checked. Without it, a post given to another author
+// meanwhile could still be written. A concurrent write then fails with
+// ErrPrecondition, as if the client had asked for that version.
+func pin(version, checked uint64) uint64 {
+	if version == 0 {
+		return checked
+	}
+	return version
+}
+
+type authors struct {
+	next storage.IAuthors
+}
+
+func NewAuthors(next storage.IAuthors) storage.IAuthors {
+	return &authors{next: next}
+}
+
+func (a *authors) Add(ctx context.Context, author *entities.Author) error {
+	if _, err := can(ctx, "add authors", auth.RoleAdmin, auth.RoleEditor); err != nil {
+		return err
+	}
+	return a.next.Add(ctx, author)
+}
+
+func (a *authors) List(ctx context.Context, opts query.Options) ([]entities.Author, string, error) {
+	return a.next.List(ctx, opts)
+}
+
+func (a *authors) Get(ctx context.Context, id uint64) (*entities.Author, error) {
+	return a.next.Get(ctx, id)
+}
+
+func (a *authors) Update(ctx context.Context, author *entities.Author) error {
+	if err := a.canWrite(ctx, author.Id); err != nil {
+		return err
+	}
+	return a.next.Update(ctx, author)
+}
+
+func (a *authors) Patch(ctx context.Context, id, version uint64, patch *entities.AuthorPatch) (*entities.Author, error) {
+	if err := a.canWrite(ctx, id); err != nil {
+		return nil, err
+	}
+	return a.next.Patch(ctx, id, version, patch)
+}
+
+func (a *authors) Delete(ctx context.Context, id, version uint64) error {
+	if _, err := can(ctx, "delete authors", auth.RoleAdmin); err != nil {
+		return err
+	}
+	return a.next.Delete(ctx, id, version)
+}
+
+// canWrite lets authors change only themselves. The author id never
+// changes, so there is nothing to pin.
+func (a *authors) canWrite(ctx context.Context, id uint64) error {
+	p, err := can(ctx, "change authors", auth.RoleAdmin, auth.RoleEditor, auth.RoleAuthor)
+	if err != nil {
+		return err
+	}
+	if isAuthor(p) && p.AuthorId != id {
+		return forbidden("%s may only change author %d", p.Subject, p.AuthorId)
+	}
+	return nil
+}
+
+type posts struct {
+	next storage.IPosts
+}
+
+func NewPosts(next storage.IPosts) storage.IPosts {
+	return &posts{next: next}
+}
+
+func (ps *posts) Add(ctx context.Context, post *entities.Post) error {
+	p, err := can(ctx, "add posts", auth.RoleAdmin, auth.RoleEditor, auth.RoleAuthor)
+	if err != nil {
+		return err
+	}
+	if isAuthor(p) && post.AuthorId != p.AuthorId {
+		return forbidden("%s may only add posts of author %d", p.Subject, p.AuthorId)
+	}
+	return ps.next.Add(ctx, post)
+}
+
+func (ps *posts) List(ctx context.Context, opts query.Options) ([]entities.Post, string, error) {
+	return ps.next.List(ctx, opts)
+}
+
+func (ps *posts) Get(ctx context.Context, id uint64) (*entities.Post, error) {
+	return ps.next.Get(ctx, id)
+}
+
+func (ps *posts) Update(ctx context.Context, post *entities.Post) error {
+	p, err := can(ctx, "change posts", auth.RoleAdmin, auth.RoleEditor, auth.RoleAuthor)
+	if err != nil {
+		return err
+	}
+	if !isAuthor(p) {
+		return ps.next.Update(ctx, post)
+	}
+
+	current, err := ps.own(ctx, p, post.Id)
+	if err != nil {
+		return err
+	}
+	if post.AuthorId != current.AuthorId {
+		return forbidden("%s may not change the author of post %d", p.Subject, post.Id)
+	}
+
+	checked := *post
+	checked.Version = pin(post.Version, current.Version)
+	if err = ps.next.Update(ctx, &checked); err != nil {
+		return err
+	}
+	post.Version = checked.Version
+	return nil
+}
+
+func (ps *posts) Patch(ctx context.Context, id, version uint64, patch *entities.PostPatch) (*entities.Post, error) {
+	p, err := can(ctx, "change posts", auth.RoleAdmin, auth.RoleEditor, auth.RoleAuthor)
+	if err != nil {
+		return nil, err
+	}
+	if !isAuthor(p) {
+		return ps.next.Patch(ctx, id, version, patch)
+	}
+
+	current, err := ps.own(ctx, p, id)
+	if err != nil {
+		return nil, err
+	}
+	if patch.AuthorId != nil && *patch.AuthorId != current.AuthorId {
+		return nil, forbidden("%s may not change the author of post %d", p.Subject, id)
+	}
+	return ps.next.Patch(ctx, id, pin(version, current.Version), patch)
+}
+
+func (ps *posts) Delete(ctx context.Context, id, version uint64) error {
+	p, err := can(ctx, "delete posts", auth.RoleAdmin, auth.RoleEditor, auth.RoleAuthor)
+	if err != nil {
+		return err
+	}
+	if !isAuthor(p) {
+		return ps.next.Delete(ctx, id, version)
+	}
+
+	current, err := ps.own(ctx, p, id)
+	if err != nil {
+		return err
+	}
+	return ps.next.Delete(ctx, id, pin(version, current.Version))
+}
+
+// own returns post id if it belongs to the author p acts as.
+func (ps *posts) own(ctx context.Context, p *auth.Principal, id uint64) (*entities.Post, error) {
+	current, err := ps.next.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current.AuthorId != p.AuthorId {
+		return nil, forbidden("%s may only change posts of author %d", p.Subject, p.AuthorId)
+	}
+	return current, nil
+}
@@ -0,0 +1,142 @@
+package authz_test
+
+import (
+	"context"
+	"crud/internal/auth"
+	"crud/internal/authz"
+	"crud/internal/config"
+	"crud/internal/entities"
+	"crud/internal/storage"
+	"crud/internal/storage/memory"
+	"errors"
+	"github.com/rs/zerolog"
+	"testing"
+	"time"
+)
+
+type fixture struct {
+	authors, rawAuthors storage.IAuthors
+	posts, rawPosts     storage.IPosts
+	alice, bob          entities.Author
+	alicePost           entities.Post
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	cfg := config.NewSnapshot(&config.Config{Database: config.DatabaseConfig{Name: "memory"}})
+	db := memory.NewDB(cfg, zerolog.Nop())
+	f := &fixture{
+		rawAuthors: memory.NewAuthors(cfg, zerolog.Nop(), db),
+		rawPosts:   memory.NewPosts(cfg, zerolog.Nop(), db),
+	}
+	f.authors = authz.NewAuthors(f.rawAuthors)
+	f.posts = authz.NewPosts(f.rawPosts)
+
+	ctx := context.Background()
+	f.alice = entities.Author{Name: "alice"}
+	f.bob = entities.Author{Name: "bob"}
+	for _, a := range []*entities.Author{&f.alice, &f.bob} {
+		if err := f.rawAuthors.Add(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.alicePost = entities.Post{AuthorId: f.alice.Id, Title: "t", Content: "c", CreatedAt: time.Now().UTC()}
+	if err := f.rawPosts.Add(ctx, &f.alicePost); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func as(role string, authorId uint64) context.Context {
+	return auth.NewContext(context.Background(), &auth.Principal{Subject: "caller", Role: role, AuthorId: authorId})
+}
+
+func assertForbidden(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, storage.ErrForbidden) {
+		t.Errorf("%s: got %v, want ErrForbidden", what, err)
+	}
+}
+
+func assertAllowed(t *testing.T, what string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Errorf("%s: got %v", what, err)
+	}
+}
+
+func TestAuthorRole(t *testing.T) {
+	f := newFixture(t)
+	ctx := as(auth.RoleAuthor, f.alice.Id)
+
+	own := entities.Post{AuthorId: f.alice.Id, Title: "mine", Content: "c", CreatedAt: time.Now().UTC()}
+	assertAllowed(t, "add own post", f.posts.Add(ctx, &own))
+	other := entities.Post{AuthorId: f.bob.Id, Title: "theirs", Content: "c", CreatedAt: time.Now().UTC()}
+	assertForbidden(t, "add post of another author", f.posts.Add(ctx, &other))
+
+	post := f.alicePost
+	post.Title = "changed"
+	assertAllowed(t, "update own post", f.posts.Update(ctx, &post))
+	if post.Version != 2 {
+		t.Errorf("got version %d after update, want 2", post.Version)
+	}
+
+	post.AuthorId = f.bob.Id
+	assertForbidden(t, "reassign own post", f.posts.Update(ctx, &post))
+	_, err := f.posts.Patch(ctx, post.Id, 0, &entities.PostPatch{AuthorId: &f.bob.Id})
+	assertForbidden(t, "patch author_id", err)
+
+	theirs := entities.Post{AuthorId: f.bob.Id, Title: "theirs", Content: "c", CreatedAt: time.Now().UTC()}
+	if err = f.rawPosts.Add(context.Background(), &theirs); err != nil {
+		t.Fatal(err)
+	}
+	title := "taken"
+	_, err = f.posts.Patch(ctx, theirs.Id, 0, &entities.PostPatch{Title: &title})
+	assertForbidden(t, "patch post of another author", err)
+	assertForbidden(t, "delete post of another author", f.posts.Delete(ctx, theirs.Id, 0))
+	assertAllowed(t, "delete own post", f.posts.Delete(ctx, own.Id, 0))
+
+	name := "alice b."
+	_, err = f.authors.Patch(ctx, f.alice.Id, 0, &entities.AuthorPatch{Name: &name})
+	assertAllowed(t, "patch own author", err)
+	_, err = f.authors.Patch(ctx, f.bob.Id, 0, &entities.AuthorPatch{Name: &name})
+	assertForbidden(t, "patch another author", err)
+	assertForbidden(t, "add author", f.authors.Add(ctx, &entities.Author{Name: "carol"}))
+	assertForbidden(t, "delete author", f.authors.Delete(ctx, f.alice.Id, 0))
+}
+
+func TestAuthorRoleStaleVersion(t *testing.T) {
+	f := newFixture(t)
+	ctx := as(auth.RoleAuthor, f.alice.Id)
+
+	post := f.alicePost
+	post.Version = 7
+	if err := f.posts.Update(ctx, &post); !errors.Is(err, storage.ErrPrecondition) {
+		t.Errorf("got %v, want the version given by the client to be kept", err)
+	}
+}
+
+func TestEditorAndAdminRoles(t *testing.T) {
+	f := newFixture(t)
+	editor := as(auth.RoleEditor, 0)
+
+	post := f.alicePost
+	post.AuthorId = f.bob.Id
+	assertAllowed(t, "editor reassigns a post", f.posts.Update(editor, &post))
+	assertAllowed(t, "editor adds an author", f.authors.Add(editor, &entities.Author{Name: "carol"}))
+	assertForbidden(t, "editor deletes an author", f.authors.Delete(editor, f.alice.Id, 0))
+
+	assertAllowed(t, "admin deletes an author", f.authors.Delete(as(auth.RoleAdmin, 0), f.alice.Id, 0))
+}
+
+func TestNoRoleAndNoPrincipal(t *testing.T) {
+	f := newFixture(t)
+	reader := as("", 0)
+
+	if _, err := f.posts.Get(reader, f.alicePost.Id); err != nil {
+		t.Errorf("reading: %v", err)
+	}
+	assertForbidden(t, "writing without a role", f.posts.Delete(reader, f.alicePost.Id, 0))
+
+	assertAllowed(t, "writing without authentication", f.posts.Delete(context.Background(), f.alicePost.Id, 0))
+}
@@ -1,48 +1,660 @@
 package config
 
 import (
-	"encoding/json"
-	"log"
-	"os"
+	"crypto/tls"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
 )
 
+// Config is loaded by Load. Every leaf can also be set with a CRUD_* variable
+// and a command-line flag named after its json path, see Load.
+//
+// Fields tagged secret are hidden by Redacted: "uri" masks the password of a
+// URI, "true" the whole value. Fields tagged reload:"live" are applied by
+// Snapshot.Apply on SIGHUP, the others need a restart.
 type Config struct {
-	LogLevel   string           `json:"log_level"`
-	HttpServer HttpServerConfig `json:"http_server"`
-	Database   DatabaseConfig   `json:"database"`
-	Postgres   PostgresConfig   `json:"postgres"`
-	Mongo      MongoConfig      `json:"mongo"`
+	LogLevel     string             `json:"log_level" reload:"live"`
+	LogRedaction LogRedactionConfig `json:"log_redaction"`
+	LogOutput    LogOutputConfig    `json:"log_output"`
+	Admin        AdminConfig        `json:"admin"`
+	Auth         AuthConfig         `json:"auth"`
+	RateLimit    RateLimitConfig    `json:"rate_limit"`
+	HttpServer   HttpServerConfig   `json:"http_server"`
+	DebugServer  DebugServerConfig  `json:"debug_server"`
+	Database     DatabaseConfig     `json:"database"`
+	Postgres     PostgresConfig     `json:"postgres"`
+	Mongo        MongoConfig        `json:"mongo"`
+	Tracing      TracingConfig      `json:"tracing"`
 }
 
-func NewConfig() *Config {
-	conf := new(Config)
-
-	b, err := os.ReadFile("./config.json")
-	if err != nil {
-		log.Fatal(err)
+// Default returns the configuration used for everything the file, the
+// environment and the flags leave out.
+func Default() *Config {
+	return &Config{
+		LogLevel: "info",
+		LogRedaction: LogRedactionConfig{
+			Deny:      []string{"name", "title", "content"},
+			Mode:      "hash",
+			MaxLength: 128,
+		},
+		LogOutput: LogOutputConfig{
+			Sinks:          []string{SinkStdout},
+			FileMaxSizeMB:  100,
+			FileMaxBackups: 10,
+			SyslogSocket:   "/dev/log",
+			SyslogTag:      "crud",
+		},
+		HttpServer: HttpServerConfig{
+			ListenAddress:     "0.0.0.0:8000",
+			ReadTimeout:       Duration(30 * time.Second),
+			ReadHeaderTimeout: Duration(30 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(30 * time.Second),
+			RequestIdPattern:  `^[A-Za-z0-9._:-]{1,128}$`,
+			AccessLog: AccessLogConfig{
+				Enabled:       true,
+				SampleRatio:   1,
+				SlowThreshold: Duration(time.Second),
+			},
+			CORS: CORSConfig{
+				AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+				AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match",
+					"X-API-Key", "x-request-id", "traceparent", "tracestate"},
+				ExposedHeaders: []string{"Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
+				MaxAge:         Duration(10 * time.Minute),
+			},
+			TLS: TLSConfig{
+				ReloadInterval: Duration(10 * time.Second),
+				MinVersion:     "1.2",
+				ClientAuth:     ClientAuthRequire,
+			},
+		},
+		Auth: AuthConfig{
+			JWTLeeway: Duration(time.Minute),
+		},
+		RateLimit: RateLimitConfig{
+			PerIP:   "100/s:200",
+			Default: "20/s:40",
+			Routes:  []string{"GET /posts=5/s:10", "GET /authors/:id/posts=5/s:10"},
+		},
+		DebugServer: DebugServerConfig{
+			ListenAddress: "127.0.0.1:6060",
+		},
+		Database: DatabaseConfig{
+			AuthorDeletePolicy: DeleteRestrict,
+		},
+		Mongo: MongoConfig{
+			DB: "crud",
+		},
+		Tracing: TracingConfig{
+			ServiceName: "crud",
+			SampleRatio: 1,
+		},
 	}
+}
 
-	err = json.Unmarshal(b, conf)
-	if err != nil {
-		log.Fatal(err)
-	}
+// LogRedactionConfig says how request data is logged, see logger.Redaction.
+// Fields are named as in the "request" object of log lines.
+type LogRedactionConfig struct {
+	// Allow, if not empty, lists the only fields logged as they are.
+	Allow []string `json:"allow" reload:"live"`
+	// Deny lists fields never logged as they are.
+	Deny []string `json:"deny" reload:"live"`
+	// Mode is what replaces the others: "mask", "hash" or "drop".
+	Mode string `json:"mode" reload:"live"`
+	// MaxLength truncates longer values. Zero keeps them whole.
+	MaxLength int `json:"max_length" reload:"live"`
+	// HashKey, if set, keys the hashes so that they can't be reversed by
+	// hashing guesses.
+	HashKey string `json:"hash_key" secret:"true" reload:"live"`
+}
 
-	return conf
+// LogOutputConfig says where logs are written. Every sink gets every line.
+type LogOutputConfig struct {
+	// Sinks are any of SinkStdout, SinkConsole, SinkFile and SinkSyslog.
+	Sinks []string `json:"sinks"`
+	// File is written by the file sink and rotated next to it.
+	File string `json:"file"`
+	// FileMaxSizeMB and FileRotateEvery start a new file when it gets that
+	// big or that old. Zero disables either.
+	FileMaxSizeMB   int      `json:"file_max_size_mb"`
+	FileRotateEvery Duration `json:"file_rotate_every"`
+	// FileMaxBackups and FileMaxAge limit how many rotated files are kept
+	// and for how long. Zero keeps them all.
+	FileMaxBackups int      `json:"file_max_backups"`
+	FileMaxAge     Duration `json:"file_max_age"`
+	// SyslogSocket is the Unix socket of the local syslog daemon.
+	SyslogSocket string `json:"syslog_socket"`
+	SyslogTag    string `json:"syslog_tag"`
+}
+
+const (
+	// SinkStdout writes JSON lines to stdout.
+	SinkStdout = "stdout"
+	// SinkConsole writes human-readable lines to stdout, for development.
+	SinkConsole = "console"
+	// SinkFile writes JSON lines to a rotated file.
+	SinkFile = "file"
+	// SinkSyslog sends JSON lines to the local syslog daemon.
+	SinkSyslog = "syslog"
+)
+
+type AdminConfig struct {
+	// Token authenticates requests to the /admin endpoints, sent as
+	// "Authorization: Bearer <token>". Empty disables them.
+	Token string `json:"token" secret:"true" reload:"live"`
+}
+
+// AuthConfig says how API requests authenticate, with an API key in
+// X-API-Key or a JWT in "Authorization: Bearer". Health, metrics and admin
+// endpoints are not concerned.
+type AuthConfig struct {
+	// Enabled rejects API requests without valid credentials.
+	Enabled bool `json:"enabled"`
+	// APIKeys are "name:hash[:role[:author_id]]" entries, hash being the
+	// hex SHA-256 of the key. The name is the principal of requests using
+	// the key. Tokens carry the role and author_id in claims of these names.
+	// A principal without a role can only read.
+	APIKeys []string `json:"api_keys"`
+	// JWKSFile holds the keys tokens may be signed with, for HS256, RS256
+	// or EdDSA. Empty disables tokens.
+	JWKSFile string `json:"jwks_file"`
+	// JWTIssuer and JWTAudience must match the iss and aud claims.
+	JWTIssuer   string `json:"jwt_issuer"`
+	JWTAudience string `json:"jwt_audience"`
+	// JWTLeeway tolerates that much clock skew on exp and nbf.
+	JWTLeeway Duration `json:"jwt_leeway"`
+	// ClientCerts are "common_name[:role[:author_id]]" entries giving roles
+	// to TLS client certificates, see http_server.tls.client_ca_file. Other
+	// verified certificates authenticate without a role.
+	ClientCerts []string `json:"client_certs"`
+}
+
+// RateLimitConfig limits API requests. Clients are told apart by their
+// principal, or by their IP address without authentication.
+type RateLimitConfig struct {
+	// Enabled applies the limits and the in-flight cap.
+	Enabled bool `json:"enabled" reload:"live"`
+	// PerIP limits every IP address over all the API routes, before
+	// authentication, so that requests with bad credentials are limited
+	// too. It should allow for clients sharing an address. "0" is
+	// unlimited.
+	PerIP string `json:"per_ip" reload:"live"`
+	// Default is the limit of a client over the routes that have none of
+	// their own, see ratelimit.ParseLimit. "0" is unlimited.
+	Default string `json:"default" reload:"live"`
+	// Routes are "METHOD /route=limit" entries, with the route as
+	// registered, such as "GET /posts/:id". A method of * matches any.
+	// Every route gets its own bucket per client.
+	Routes []string `json:"routes" reload:"live"`
+	// TrustedProxies are the CIDRs of proxies whose X-Forwarded-For is
+	// believed to find the client address.
+	TrustedProxies []string `json:"trusted_proxies" reload:"live"`
+	// MaxInFlight answers 503 to API requests beyond that many at once, so
+	// that they don't queue for database connections. Zero means no limit.
+	MaxInFlight int `json:"max_in_flight" reload:"live"`
+}
+
+// DebugServerConfig is for the listener serving pprof, runtime and build
+// information and the redacted config. It has no authentication, so it only
+// listens on loopback addresses.
+type DebugServerConfig struct {
+	Enabled       bool   `json:"enabled"`
+	ListenAddress string `json:"listen_address"`
 }
 
 type HttpServerConfig struct {
 	ListenAddress string `json:"listen_address"`
+	// The connection timeouts are those of http.Server, which reads them
+	// while serving, so they can't be swapped under it: a reload reports
+	// their changes as needing a restart. RequestTimeout is live.
+	ReadTimeout       Duration `json:"read_timeout"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	WriteTimeout      Duration `json:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	// RequestTimeout bounds the handling of a request, storage calls
+	// included. Zero means no limit.
+	RequestTimeout Duration `json:"request_timeout" reload:"live"`
+	// DrainDelay is how long /readyz fails before the server stops taking
+	// requests on shutdown, for load balancers to notice.
+	DrainDelay Duration `json:"drain_delay" reload:"live"`
+	// RequestIdPattern is what an incoming x-request-id must match to be
+	// kept, others are replaced by a new one. Empty ignores them all.
+	RequestIdPattern string `json:"request_id_pattern"`
+
+	AccessLog AccessLogConfig `json:"access_log"`
+	CORS      CORSConfig      `json:"cors"`
+	TLS       TLSConfig       `json:"tls"`
+}
+
+// AccessLogConfig controls the line logged for every request. Failed and
+// slow requests are always logged, the others are sampled.
+type AccessLogConfig struct {
+	Enabled bool `json:"enabled"`
+	// SampleRatio is the share of requests answered below 400 that are
+	// logged, from 0 to 1.
+	SampleRatio float64 `json:"sample_ratio" reload:"live"`
+	// SlowThreshold logs every request taking longer. Zero disables it.
+	SlowThreshold Duration `json:"slow_threshold" reload:"live"`
+}
+
+// CORSConfig lets browsers on other origins call the API. Without allowed
+// origins, no CORS headers are sent.
+type CORSConfig struct {
+	// AllowedOrigins are origins such as "https://app.example.com". A
+	// "https://*.example.com" matches any subdomain, "*" any origin.
+	AllowedOrigins []string `json:"allowed_origins" reload:"live"`
+	// AllowedMethods and AllowedHeaders are what preflight requests may
+	// ask for. Header names are compared case-insensitively.
+	AllowedMethods []string `json:"allowed_methods" reload:"live"`
+	AllowedHeaders []string `json:"allowed_headers" reload:"live"`
+	// ExposedHeaders are readable by scripts, besides x-request-id and ETag
+	// that always are.
+	ExposedHeaders []string `json:"exposed_headers" reload:"live"`
+	// AllowCredentials lets cookies and Authorization be sent. It can't be
+	// combined with the "*" origin.
+	AllowCredentials bool `json:"allow_credentials" reload:"live"`
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge Duration `json:"max_age" reload:"live"`
+}
+
+// TLSConfig makes the HTTP server speak TLS only.
+type TLSConfig struct {
+	Enabled  bool   `json:"enabled"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ReloadInterval is how often the files are checked for a renewed
+	// certificate.
+	ReloadInterval Duration `json:"reload_interval"`
+	// MinVersion is "1.2" or "1.3".
+	MinVersion string `json:"min_version"`
+	// CipherSuites are the TLS 1.2 suites allowed, by their Go names such
+	// as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Empty keeps the Go
+	// defaults. TLS 1.3 suites are not configurable.
+	CipherSuites []string `json:"cipher_suites"`
+	// ClientCAFile, if set, holds the CAs of client certificates, which
+	// then authenticate requests, see AuthConfig.ClientCerts.
+	ClientCAFile string `json:"client_ca_file"`
+	// ClientAuth is ClientAuthRequire or ClientAuthOptional.
+	ClientAuth string `json:"client_auth"`
+}
+
+const (
+	// ClientAuthRequire refuses connections without a valid client
+	// certificate.
+	ClientAuthRequire = "require"
+	// ClientAuthOptional checks client certificates if sent, requests
+	// without one may use other credentials.
+	ClientAuthOptional = "optional"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Version returns MinVersion for tls.Config.
+func (c TLSConfig) Version() uint16 {
+	return tlsVersions[c.MinVersion]
+}
+
+// Suites returns CipherSuites for tls.Config, nil if empty.
+func (c TLSConfig) Suites() []uint16 {
+	var ids []uint16
+	for _, name := range c.CipherSuites {
+		if id, ok := cipherSuite(name); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// cipherSuite finds a suite by name among those Go deems secure.
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Duration is a time.Duration written as "30s" in the config file.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
 }
 
 type DatabaseConfig struct {
+	// Name is the storage backend: "postgres", "mongo" or "memory".
 	Name string `json:"name"`
+	// AuthorDeletePolicy says what happens to the posts of a deleted author:
+	// DeleteRestrict (the default), DeleteCascade or DeleteOrphan.
+	AuthorDeletePolicy string `json:"author_delete_policy"`
+	// AutoMigrate applies pending migrations at startup. Without it the
+	// server refuses to start until "migrate up" has been run.
+	AutoMigrate bool `json:"auto_migrate"`
 }
 
+const (
+	// DeleteRestrict refuses to delete an author who still has posts.
+	DeleteRestrict = "restrict"
+	// DeleteCascade deletes the posts together with their author.
+	DeleteCascade = "cascade"
+	// DeleteOrphan keeps the posts and clears their author_id.
+	DeleteOrphan = "orphan"
+)
+
 type PostgresConfig struct {
-	URI string `json:"URI"`
+	URI string `json:"URI" secret:"uri"`
+	// CommentQueries prefixes the statements of a request with its
+	// request_id. They are then sent with the simple protocol, as their text
+	// is unique, which costs the prepared statement cache.
+	CommentQueries bool `json:"comment_queries" reload:"live"`
 }
 
 type MongoConfig struct {
-	URI string `json:"URI"`
-	DB  string `env:"DB"`
+	URI string `json:"URI" secret:"uri"`
+	DB  string `json:"DB"`
+}
+
+type TracingConfig struct {
+	// Exporter is where spans go: "" to only propagate trace ids, "stdout",
+	// "file" or "otlp".
+	Exporter string `json:"exporter"`
+	// File is appended to by the file exporter.
+	File string `json:"file"`
+	// OTLPEndpoint is the OTLP/HTTP traces URL, e.g.
+	// http://localhost:4318/v1/traces.
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	// OTLPHeaders are "Name=value" headers sent to the endpoint.
+	OTLPHeaders []string `json:"otlp_headers" secret:"true"`
+	ServiceName string   `json:"service_name"`
+	// SampleRatio is the share of traces started here that are exported.
+	// Traces of callers follow their sampled flag.
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// ValidationError lists every problem Validate found.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks the configuration and reports all problems at once. The
+// entries that other packages parse, such as API keys and rate limits, are
+// left to them.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil || c.LogLevel == "" {
+		add("log_level: unknown level %q", c.LogLevel)
+	}
+	switch c.LogRedaction.Mode {
+	case "mask", "hash", "drop":
+	default:
+		add("log_redaction.mode: %q is not mask, hash or drop", c.LogRedaction.Mode)
+	}
+	if c.LogRedaction.MaxLength < 0 {
+		add("log_redaction.max_length: %d is negative", c.LogRedaction.MaxLength)
+	}
+
+	out := c.LogOutput
+	if len(out.Sinks) == 0 {
+		add("log_output.sinks: at least one sink is required")
+	}
+	seen := make(map[string]bool)
+	for _, sink := range out.Sinks {
+		switch {
+		case sink != SinkStdout && sink != SinkConsole && sink != SinkFile && sink != SinkSyslog:
+			add("log_output.sinks: %q is not stdout, console, file or syslog", sink)
+		case seen[sink]:
+			add("log_output.sinks: %q is listed twice", sink)
+		}
+		seen[sink] = true
+	}
+	if seen[SinkFile] && out.File == "" {
+		add("log_output.file: required by the file sink")
+	}
+	if seen[SinkSyslog] && out.SyslogSocket == "" {
+		add("log_output.syslog_socket: required by the syslog sink")
+	}
+	if seen[SinkSyslog] && (runtime.GOOS == "windows" || runtime.GOOS == "plan9") {
+		add("log_output.sinks: syslog is not supported on %s", runtime.GOOS)
+	}
+	if out.FileMaxSizeMB < 0 {
+		add("log_output.file_max_size_mb: %d is negative", out.FileMaxSizeMB)
+	}
+	if out.FileMaxBackups < 0 {
+		add("log_output.file_max_backups: %d is negative", out.FileMaxBackups)
+	}
+
+	if _, _, err := net.SplitHostPort(c.HttpServer.ListenAddress); err != nil {
+		add("http_server.listen_address: %v", err)
+	}
+	if _, err := regexp.Compile(c.HttpServer.RequestIdPattern); err != nil {
+		add("http_server.request_id_pattern: %v", err)
+	}
+	for _, f := range fields(c) {
+		if d, ok := f.value.Interface().(Duration); ok && d < 0 {
+			add("%s: negative duration %s", f.name(), d)
+		}
+	}
+
+	if a := c.Auth; a.Enabled {
+		if len(a.APIKeys) == 0 && a.JWKSFile == "" && c.HttpServer.TLS.ClientCAFile == "" {
+			add("auth: api_keys, jwks_file or http_server.tls.client_ca_file is required when enabled")
+		}
+		if a.JWKSFile != "" && (a.JWTIssuer == "" || a.JWTAudience == "") {
+			add("auth: jwt_issuer and jwt_audience are required with jwks_file")
+		}
+	}
+
+	if t := c.HttpServer.TLS; t.Enabled {
+		if t.CertFile == "" || t.KeyFile == "" {
+			add("http_server.tls: cert_file and key_file are required when enabled")
+		}
+		if _, ok := tlsVersions[t.MinVersion]; !ok {
+			add("http_server.tls.min_version: %q is not 1.2 or 1.3", t.MinVersion)
+		}
+		for _, name := range t.CipherSuites {
+			if _, ok := cipherSuite(name); !ok {
+				add("http_server.tls.cipher_suites: %q is not a secure cipher suite", name)
+			}
+		}
+		if t.ClientAuth != ClientAuthRequire && t.ClientAuth != ClientAuthOptional {
+			add("http_server.tls.client_auth: %q is not %s or %s", t.ClientAuth, ClientAuthRequire, ClientAuthOptional)
+		}
+	} else if t.ClientCAFile != "" {
+		add("http_server.tls.client_ca_file: needs tls to be enabled")
+	}
+
+	for _, cidr := range c.RateLimit.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			add("rate_limit.trusted_proxies: %v", err)
+		}
+	}
+	if c.RateLimit.MaxInFlight < 0 {
+		add("rate_limit.max_in_flight: %d is negative", c.RateLimit.MaxInFlight)
+	}
+
+	if c.DebugServer.Enabled {
+		if err := checkLoopback(c.DebugServer.ListenAddress); err != nil {
+			add("debug_server.listen_address: %v", err)
+		}
+	}
+
+	switch c.Database.Name {
+	case "postgres":
+		if c.Postgres.URI == "" {
+			add("postgres.URI: required by the postgres database")
+		}
+	case "mongo":
+		if c.Mongo.URI == "" {
+			add("mongo.URI: required by the mongo database")
+		}
+		if c.Mongo.DB == "" {
+			add("mongo.DB: required by the mongo database")
+		}
+	case "memory":
+	case "":
+		add("database.name: required, one of postgres, mongo, memory")
+	default:
+		add("database.name: unknown database %q, expected postgres, mongo or memory", c.Database.Name)
+	}
+
+	switch c.Database.AuthorDeletePolicy {
+	case DeleteRestrict, DeleteCascade, DeleteOrphan:
+	default:
+		add("database.author_delete_policy: unknown policy %q, expected %s, %s or %s",
+			c.Database.AuthorDeletePolicy, DeleteRestrict, DeleteCascade, DeleteOrphan)
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			add("tracing.file: required by the file exporter")
+		}
+	case "otlp":
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			add("tracing.otlp_endpoint: required by the otlp exporter, an absolute URL")
+		}
+	default:
+		add("tracing.exporter: unknown exporter %q, expected stdout, file or otlp", c.Tracing.Exporter)
+	}
+	for _, header := range c.Tracing.OTLPHeaders {
+		if name, _, ok := strings.Cut(header, "="); !ok || name == "" {
+			add("tracing.otlp_headers: %q is not Name=value", header)
+		}
+	}
+	for _, origin := range c.HttpServer.CORS.AllowedOrigins {
+		if err := checkOrigin(origin); err != nil {
+			add("http_server.cors.allowed_origins: %v", err)
+		}
+		if origin == "*" && c.HttpServer.CORS.AllowCredentials {
+			add("http_server.cors.allow_credentials: can't be used with the * origin")
+		}
+	}
+	if r := c.HttpServer.AccessLog.SampleRatio; r < 0 || r > 1 {
+		add("http_server.access_log.sample_ratio: %v is not between 0 and 1", r)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio: %v is not between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkLoopback fails unless addr is host:port with a loopback host.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q is not a loopback address", host)
+	}
+	return nil
+}
+
+// checkOrigin fails unless origin is "*" or scheme://host[:port], with
+// maybe a "*." in front of the host.
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q is not scheme://host[:port]", origin)
+	}
+	return nil
+}
+
+// Redacted returns a copy that is safe to print or log.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	for _, f := range fields(&redacted) {
+		mode := f.tag.Get("secret")
+		if mode == "" {
+			continue
+		}
+		switch f.value.Kind() {
+		case reflect.String:
+			if f.value.String() != "" {
+				f.value.SetString(redact(f.value.String(), mode))
+			}
+		case reflect.Slice:
+			// A new slice, the copy shares the backing array with c.
+			items := make([]string, f.value.Len())
+			for i := range items {
+				items[i] = redact(f.value.Index(i).String(), mode)
+			}
+			if len(items) > 0 {
+				f.value.Set(reflect.ValueOf(items))
+			}
+		}
+	}
+	return &redacted
+}
+
+const redactedValue = "REDACTED"
+
+// keyValuePassword finds the password of a key/value DSN such as
+// "host=db password='s3 cret'", quoted or not.
+var keyValuePassword = regexp.MustCompile(`(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func redact(value, mode string) string {
+	if mode != "uri" {
+		return redactedValue
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return redactedValue
+	}
+	if u.Scheme == "" {
+		// pgx also takes key/value DSNs.
+		return keyValuePassword.ReplaceAllString(value, "${1}"+redactedValue)
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+	}
+	// libpq also takes the password as a query parameter.
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", redactedValue)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
 }
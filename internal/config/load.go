@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFile is read when no -config flag is given, if it exists.
+const DefaultFile = "./config.json"
+
+// EnvPrefix starts the name of every environment variable Load reads.
+const EnvPrefix = "CRUD_"
+
+// Load builds the configuration from, in increasing priority:
+//   - Default();
+//   - the JSON file named by the -config flag, DefaultFile if there is none;
+//   - environment variables named after the json path of a field, e.g.
+//     CRUD_POSTGRES_URI for postgres.URI. CRUD_POSTGRES_URI_FILE reads the
+//     value from a file instead, which suits mounted secrets;
+//   - flags named the same way, e.g. -postgres.uri.
+//
+// The result is validated. Load returns the arguments left after the flags,
+// e.g. a subcommand. lookupEnv is os.LookupEnv outside of tests.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, []string, error) {
+	cfg := Default()
+	leaves := fields(cfg)
+
+	fs := flag.NewFlagSet("crud", flag.ContinueOnError)
+	file := fs.String("config", "", "path to the JSON config file (default "+DefaultFile+" if it exists)")
+	var flagValues []setting
+	for _, f := range leaves {
+		fs.Var(&flagRecorder{field: f, settings: &flagValues}, f.flagName(),
+			"overrides "+f.envName())
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := loadFile(cfg, *file); err != nil {
+		return nil, nil, err
+	}
+
+	var errs ValidationError
+	for _, f := range leaves {
+		value, ok, err := envValue(f, lookupEnv)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err = f.set(value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.envName(), err))
+		}
+	}
+	for _, s := range flagValues {
+		if err := s.field.set(s.value); err != nil {
+			errs = append(errs, fmt.Sprintf("-%s: %v", s.field.flagName(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// envValue reads the variable of a field, or the file its _FILE variant
+// names. Setting both is a mistake.
+func envValue(f field, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	name := f.envName()
+	value, ok := lookupEnv(name)
+	path, fromFile := lookupEnv(name + "_FILE")
+	if !fromFile {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("%s and %s_FILE are both set", name, name)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// field is a leaf of Config, addressed by the json names on its path.
+type field struct {
+	path  []string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// name is the json path of the field, as in validation errors.
+func (f field) name() string {
+	return strings.Join(f.path, ".")
+}
+
+func (f field) flagName() string {
+	return strings.ToLower(strings.Join(f.path, "."))
+}
+
+func (f field) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.Join(f.path, "_"))
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// set parses s into the field. Lists are comma-separated.
+func (f field) set(s string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Uint, v.Kind() == reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %s", v.Type()))
+	}
+	return nil
+}
+
+// fields lists the leaves of cfg in declaration order.
+func fields(cfg *Config) []field {
+	var leaves []field
+
+	var walk func(v reflect.Value, path []string)
+	walk = func(v reflect.Value, path []string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if name == "-" || !sf.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+
+			fieldPath := append(append([]string(nil), path...), name)
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				walk(v.Field(i), fieldPath)
+				continue
+			}
+			leaves = append(leaves, field{path: fieldPath, value: v.Field(i), tag: sf.Tag})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), nil)
+
+	return leaves
+}
+
+type setting struct {
+	field field
+	value string
+}
+
+// flagRecorder keeps flag values aside, so that they are applied after the
+// file and the environment whatever order things are parsed in.
+type flagRecorder struct {
+	field    field
+	settings *[]setting
+}
+
+func (r *flagRecorder) String() string {
+	if r == nil || !r.field.value.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(r.field.value.Interface())
+}
+
+func (r *flagRecorder) Set(s string) error {
+	// Catch type errors while flag can still name the culprit.
+	probe := field{value: reflect.New(r.field.value.Type()).Elem()}
+	if err := probe.set(s); err != nil {
+		return err
+	}
+	*r.settings = append(*r.settings, setting{field: r.field, value: s})
+	return nil
+}
+
+func (r *flagRecorder) IsBoolFlag() bool {
+	return r.field.value.Kind() == reflect.Bool
+}
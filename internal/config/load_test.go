@@ -0,0 +1,245 @@
+package config_test
+
+import (
+	"crud/internal/config"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.json", `{
+		"log_level": "debug",
+		"database": {"name": "postgres"},
+		"postgres": {"URI": "postgres://file"},
+		"mongo": {"DB": "from-file"}
+	}`)
+
+	cfg, args, err := config.Load(
+		[]string{"-config", file, "-postgres.uri", "postgres://flag", "migrate", "up"},
+		env(map[string]string{
+			"CRUD_LOG_LEVEL":    "warn",
+			"CRUD_POSTGRES_URI": "postgres://env",
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.HttpServer.ListenAddress != "0.0.0.0:8000" {
+		t.Errorf("listen address %q, want the default", cfg.HttpServer.ListenAddress)
+	}
+	if cfg.Mongo.DB != "from-file" {
+		t.Errorf("mongo db %q, want the file value", cfg.Mongo.DB)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("log level %q, want the env value", cfg.LogLevel)
+	}
+	if cfg.Postgres.URI != "postgres://flag" {
+		t.Errorf("postgres uri %q, want the flag value", cfg.Postgres.URI)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args %q, want the subcommand", args)
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	secret := writeFile(t, "uri", "mongodb://user:secret@db\n")
+
+	cfg, _, err := config.Load(nil, env(map[string]string{
+		"CRUD_DATABASE_NAME":  "mongo",
+		"CRUD_MONGO_URI_FILE": secret,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mongo.URI != "mongodb://user:secret@db" {
+		t.Errorf("mongo uri %q, want the file content", cfg.Mongo.URI)
+	}
+
+	_, _, err = config.Load(nil, env(map[string]string{
+		"CRUD_DATABASE_NAME":  "mongo",
+		"CRUD_MONGO_URI":      "mongodb://db",
+		"CRUD_MONGO_URI_FILE": secret,
+	}))
+	if err == nil || !strings.Contains(err.Error(), "both set") {
+		t.Errorf("got %v, want both set", err)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, _, err := config.Load(
+		[]string{"-http_server.listen_address", "nowhere"},
+		env(map[string]string{
+			"CRUD_LOG_LEVEL":                     "loud",
+			"CRUD_DATABASE_NAME":                 "postgres",
+			"CRUD_DATABASE_AUTHOR_DELETE_POLICY": "shrug",
+		}))
+
+	var verr config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	for _, want := range []string{"log_level", "http_server.listen_address", "postgres.URI", "author_delete_policy"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v does not mention %s", err, want)
+		}
+	}
+	if len(verr) != 4 {
+		t.Errorf("got %d problems, want 4", len(verr))
+	}
+}
+
+func TestLoadCORSOrigins(t *testing.T) {
+	_, _, err := config.Load(nil, env(map[string]string{
+		"CRUD_DATABASE_NAME":                    "memory",
+		"CRUD_HTTP_SERVER_CORS_ALLOWED_ORIGINS": "https://*.example.com,http://localhost:3000",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = config.Load(nil, env(map[string]string{
+		"CRUD_DATABASE_NAME":                      "memory",
+		"CRUD_HTTP_SERVER_CORS_ALLOWED_ORIGINS":   "*,example.com,https://app.example.com/",
+		"CRUD_HTTP_SERVER_CORS_ALLOW_CREDENTIALS": "true",
+	}))
+	var verr config.ValidationError
+	if !errors.As(err, &verr) || len(verr) != 3 {
+		t.Errorf("got %v, want the credentials and 2 origins reported", err)
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	_, _, err := config.Load(nil, env(map[string]string{
+		"CRUD_DATABASE_NAME":                 "memory",
+		"CRUD_HTTP_SERVER_TLS_ENABLED":       "true",
+		"CRUD_HTTP_SERVER_TLS_MIN_VERSION":   "1.0",
+		"CRUD_HTTP_SERVER_TLS_CIPHER_SUITES": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_RSA_WITH_RC4_128_SHA",
+		"CRUD_HTTP_SERVER_TLS_CLIENT_AUTH":   "sometimes",
+	}))
+	var verr config.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	for _, want := range []string{"cert_file", "min_version", "TLS_RSA_WITH_RC4_128_SHA", "client_auth"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%v does not mention %s", err, want)
+		}
+	}
+	if len(verr) != 4 {
+		t.Errorf("got %d problems, want 4", len(verr))
+	}
+}
+
+func TestLoadBadValues(t *testing.T) {
+	_, _, err := config.Load(nil, env(map[string]string{
+		"CRUD_DATABASE_NAME":         "memory",
+		"CRUD_DATABASE_AUTO_MIGRATE": "maybe",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "CRUD_DATABASE_AUTO_MIGRATE") {
+		t.Errorf("got %v, want the variable named", err)
+	}
+
+	_, _, err = config.Load([]string{"-database.auto_migrate=maybe"}, env(nil))
+	if err == nil {
+		t.Error("a bad flag value was accepted")
+	}
+
+	_, _, err = config.Load([]string{"-config", filepath.Join(t.TempDir(), "missing.json")}, env(nil))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want a missing explicit file to fail", err)
+	}
+
+	file := writeFile(t, "config.json", `{"database": {"nmae": "memory"}}`)
+	_, _, err = config.Load([]string{"-config", file}, env(nil))
+	if err == nil || !strings.Contains(err.Error(), "nmae") {
+		t.Errorf("got %v, want the unknown field named", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.Postgres.URI = "postgres://user:secret@db/crud?sslmode=disable"
+	cfg.Mongo.URI = "mongodb://db/?password=secret"
+
+	redacted := cfg.Redacted()
+	for _, uri := range []string{redacted.Postgres.URI, redacted.Mongo.URI} {
+		if strings.Contains(uri, "secret") || !strings.Contains(uri, "REDACTED") {
+			t.Errorf("%s is not redacted", uri)
+		}
+	}
+	if !strings.Contains(redacted.Postgres.URI, "user:") || !strings.Contains(redacted.Postgres.URI, "sslmode=disable") {
+		t.Errorf("%s lost more than the password", redacted.Postgres.URI)
+	}
+	if cfg.Postgres.URI != "postgres://user:secret@db/crud?sslmode=disable" {
+		t.Error("Redacted changed the original")
+	}
+}
+
+func TestRedactedKeyValueDSN(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"host=db user=app password=s3cret dbname=crud":    "host=db user=app password=REDACTED dbname=crud",
+		"host=db password = 's3 \\'cret' sslmode=disable": "host=db password = REDACTED sslmode=disable",
+		"host=db user=app": "host=db user=app",
+	} {
+		cfg := config.Default()
+		cfg.Postgres.URI = dsn
+		if got := cfg.Redacted().Postgres.URI; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestSnapshotApply(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Name = "memory"
+	snapshot := config.NewSnapshot(cfg)
+
+	next := *cfg
+	next.LogLevel = "debug"
+	next.HttpServer.RequestTimeout = config.Duration(time.Second)
+	next.HttpServer.AccessLog.SampleRatio = 0.5
+	next.HttpServer.ListenAddress = "127.0.0.1:9000"
+	next.HttpServer.ReadTimeout = config.Duration(time.Minute)
+	next.HttpServer.IdleTimeout = config.Duration(time.Minute)
+	next.Database.Name = "postgres"
+
+	applied, restart := snapshot.Apply(&next)
+	if strings.Join(applied, " ") != "log_level http_server.request_timeout http_server.access_log.sample_ratio" {
+		t.Errorf("applied %q", applied)
+	}
+	if strings.Join(restart, " ") != "http_server.listen_address http_server.read_timeout http_server.idle_timeout database.name" {
+		t.Errorf("restart %q", restart)
+	}
+
+	current := snapshot.Load()
+	if current.LogLevel != "debug" || current.HttpServer.RequestTimeout != config.Duration(time.Second) {
+		t.Errorf("live fields not applied: %+v", current)
+	}
+	if current.HttpServer.ListenAddress != cfg.HttpServer.ListenAddress || current.Database.Name != "memory" ||
+		current.HttpServer.ReadTimeout != cfg.HttpServer.ReadTimeout {
+		t.Errorf("restart fields applied: %+v", current)
+	}
+	if cfg.LogLevel != "info" {
+		t.Error("Apply changed the previous config")
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshot holds the configuration in effect. Readers call Load for every
+// use instead of keeping the *Config, so that a reload reaches them.
+type Snapshot struct {
+	cfg atomic.Pointer[Config]
+	// mu serializes Apply, readers never take it.
+	mu sync.Mutex
+}
+
+func NewSnapshot(cfg *Config) *Snapshot {
+	s := new(Snapshot)
+	s.cfg.Store(cfg)
+	return s
+}
+
+// Load returns the current configuration. It must not be modified.
+func (s *Snapshot) Load() *Config {
+	return s.cfg.Load()
+}
+
+// Apply swaps in the fields of next tagged reload:"live" and leaves the
+// others as they are. It returns the json paths of the live fields it
+// changed, and of the other fields that differ and need a restart.
+func (s *Snapshot) Apply(next *Config) (applied, restart []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg := *s.Load()
+	nextFields := fields(next)
+	for i, f := range fields(&cfg) {
+		value := nextFields[i].value
+		if reflect.DeepEqual(f.value.Interface(), value.Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") != "live" {
+			restart = append(restart, f.name())
+			continue
+		}
+		f.value.Set(value)
+		applied = append(applied, f.name())
+	}
+	s.cfg.Store(&cfg)
+
+	return applied, restart
+}
@@ -1,3 +1,6 @@
 package constants
 
 var RequestIdKey = "x-request-id"
+
+// PrincipalKey holds the authenticated principal of a request.
+var PrincipalKey = "principal"
@@ -0,0 +1,105 @@
+// Package debug_server serves profiling and runtime information on a
+// listener of its own, apart from the API.
+package debug_server
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/storage"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+	"time"
+)
+
+type Server struct {
+	cfg        *config.Snapshot
+	lgr        zerolog.Logger
+	stor       *storage.Storage
+	httpServer *http.Server
+}
+
+// NewServer starts serving on the debug listen address. There are no write
+// timeouts: CPU profiles and traces take as long as they are asked to.
+func NewServer(cfg *config.Snapshot, lgr zerolog.Logger, stor *storage.Storage) (*Server, chan error) {
+	lgr = lgr.With().Str("component", "debug_server").Logger()
+	addr := cfg.Load().DebugServer.ListenAddress
+
+	netListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		lgr.Fatal().Err(err).Msgf("failed to start listener for debug server on %s", addr)
+	}
+	lgr.Info().Msgf("start listener for debug server success on %s", addr)
+
+	server := &Server{
+		cfg:  cfg,
+		lgr:  lgr,
+		stor: stor,
+		httpServer: &http.Server{
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/goroutines", server.goroutines)
+	mux.HandleFunc("/debug/build", server.build)
+	mux.HandleFunc("/debug/config", server.config)
+	mux.HandleFunc("/debug/pools", server.pools)
+	server.httpServer.Handler = mux
+
+	listenErrCh := make(chan error, 1)
+	go func() {
+		listenErrCh <- server.httpServer.Serve(netListener)
+	}()
+
+	return server, listenErrCh
+}
+
+func (srv *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := srv.httpServer.Shutdown(ctx)
+	if err != nil {
+		srv.lgr.Error().Err(err).Msg("debug server grace shutdown finished with error")
+		return err
+	}
+
+	srv.lgr.Debug().Msg("debug server grace shutdown success")
+	return nil
+}
+
+// goroutines dumps the stacks of all goroutines, as a panic would.
+func (srv *Server) goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func (srv *Server) build(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, readBuildInfo())
+}
+
+// config shows the configuration in effect, reloads included.
+func (srv *Server) config(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, srv.cfg.Load().Redacted())
+}
+
+func (srv *Server) pools(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{"database": srv.stor.PoolStats()})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(v)
+}
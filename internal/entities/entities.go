@@ -3,14 +3,66 @@ package entities
 import "time"
 
 type Author struct {
-	Id   uint64 `json:"id,omitempty" db:"id"`
-	Name string `json:"name,omitempty" db:"name,omitempty"`
+	Id   uint64 `json:"id,omitempty" db:"id" bson:"id"`
+	Name string `json:"name,omitempty" db:"name,omitempty" bson:"name"`
+	// Version starts at 1 and is incremented by every write.
+	Version uint64 `json:"version" db:"version" bson:"version"`
 }
 
 type Post struct {
-	Id        uint64    `json:"id" db:"id"`
-	AuthorId  uint64    `json:"author_id" db:"author_id"`
-	Title     string    `json:"title" db:"title,omitempty"`
-	Content   string    `json:"content" db:"content,omitempty"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Id        uint64    `json:"id" db:"id" bson:"id"`
+	AuthorId  uint64    `json:"author_id" db:"author_id" bson:"author_id"`
+	Title     string    `json:"title" db:"title,omitempty" bson:"title"`
+	Content   string    `json:"content" db:"content,omitempty" bson:"content"`
+	CreatedAt time.Time `json:"created_at" db:"created_at" bson:"created_at"`
+	// Version starts at 1 and is incremented by every write.
+	Version uint64 `json:"version" db:"version" bson:"version"`
+}
+
+// AuthorPatch and PostPatch hold partial updates: only non-nil fields are
+// written.
+type AuthorPatch struct {
+	Name *string
+}
+
+func (p *AuthorPatch) Empty() bool {
+	return p.Name == nil
+}
+
+// Fields lists the json names of the fields set in the patch.
+func (p *AuthorPatch) Fields() []string {
+	fields := make([]string, 0, 1)
+	if p.Name != nil {
+		fields = append(fields, "name")
+	}
+	return fields
+}
+
+type PostPatch struct {
+	AuthorId  *uint64
+	Title     *string
+	Content   *string
+	CreatedAt *time.Time
+}
+
+func (p *PostPatch) Empty() bool {
+	return p.AuthorId == nil && p.Title == nil && p.Content == nil && p.CreatedAt == nil
+}
+
+// Fields lists the json names of the fields set in the patch.
+func (p *PostPatch) Fields() []string {
+	fields := make([]string, 0, 4)
+	if p.AuthorId != nil {
+		fields = append(fields, "author_id")
+	}
+	if p.Title != nil {
+		fields = append(fields, "title")
+	}
+	if p.Content != nil {
+		fields = append(fields, "content")
+	}
+	if p.CreatedAt != nil {
+		fields = append(fields, "created_at")
+	}
+	return fields
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"crud/internal/constants"
+	"github.com/rs/zerolog"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// accessKey holds the *accessRecord of a request, filled in by the
+// middlewares for the access log.
+type accessKey struct{}
+
+type accessRecord struct {
+	// route is the template the request matched.
+	route     string
+	principal string
+}
+
+// AccessLog logs one line per request handled by next, usually the router.
+// Requests answered below 400 are sampled, failed and slow ones are always
+// logged.
+func (h *Handler) AccessLog(next http.Handler) http.Handler {
+	lgr := h.lgr.With().Str("component", "access_log").Logger()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.cfg.Load().HttpServer.AccessLog.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		record := new(accessRecord)
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, record))
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		status := rec.Status()
+
+		cfg := h.cfg.Load().HttpServer.AccessLog
+		slow := cfg.SlowThreshold > 0 && duration > time.Duration(cfg.SlowThreshold)
+
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = lgr.Error()
+		case status >= http.StatusBadRequest || slow:
+			event = lgr.Warn()
+		case cfg.SampleRatio >= 1 || rand.Float64() < cfg.SampleRatio:
+			event = lgr.Info()
+		default:
+			return
+		}
+
+		event.
+			Str("method", r.Method).
+			Str("route", record.route).
+			Str("path", r.URL.Path).
+			Int("status", status).
+			Dur("duration", duration).
+			Int("size", rec.size).
+			Str("remote_addr", r.RemoteAddr).
+			Str("user_agent", r.UserAgent()).
+			Str(constants.RequestIdKey, w.Header().Get(constants.RequestIdKey)).
+			Str(constants.PrincipalKey, record.principal).
+			Bool("slow", slow).
+			Msg("request")
+	})
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crud/pkg/logger"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Admin lets handle through only requests bearing the admin token. Without
+// a token configured the admin endpoints don't exist.
+func (h *Handler) Admin(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token := h.cfg.Load().Admin.Token
+		if token == "" {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(auth, "Bearer ")
+		if given == auth || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		handle(w, r, ps)
+	}
+}
+
+// levelOverride is a log level set through the admin endpoint, reverted to
+// the configured one by a timer.
+type levelOverride struct {
+	// change counts the changes, so that a timer fired after a later change
+	// does nothing.
+	change   uint64
+	timer    *time.Timer
+	revertAt time.Time
+}
+
+func (h *Handler) GetLogLevel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	h.levelMu.Lock()
+	defer h.levelMu.Unlock()
+
+	h.writeLogLevel(w)
+}
+
+// SetLogLevel changes the level of every logger. With revert_after the
+// configured level comes back after that long, a config reload brings it
+// back sooner.
+func (h *Handler) SetLogLevel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer r.Body.Close()
+
+	request := new(LogLevelReq)
+	err := decodeRequest(r.Body, request)
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+	if request.RevertAfter < 0 {
+		writeError(w, http.StatusUnprocessableEntity, "revert_after is negative")
+		return
+	}
+
+	h.levelMu.Lock()
+	defer h.levelMu.Unlock()
+
+	previous := zerolog.GlobalLevel()
+	if _, err = logger.SetLevel(request.Level); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("unknown level %q", request.Level))
+		return
+	}
+
+	if h.levelOverride.timer != nil {
+		h.levelOverride.timer.Stop()
+	}
+	change := h.levelOverride.change + 1
+	h.levelOverride = levelOverride{change: change}
+	if d := time.Duration(request.RevertAfter); d > 0 {
+		h.levelOverride.timer = time.AfterFunc(d, func() { h.revertLogLevel(change) })
+		h.levelOverride.revertAt = time.Now().Add(d)
+	}
+
+	h.lgr.Warn().
+		Str("from", previous.String()).
+		Str("to", request.Level).
+		Stringer("revert_after", request.RevertAfter).
+		Msg("log level changed")
+
+	h.writeLogLevel(w)
+}
+
+// revertLogLevel goes back to the configured level, unless the level was
+// changed again since change.
+func (h *Handler) revertLogLevel(change uint64) {
+	h.levelMu.Lock()
+	defer h.levelMu.Unlock()
+
+	if h.levelOverride.change != change {
+		return
+	}
+
+	level := h.cfg.Load().LogLevel
+	if _, err := logger.SetLevel(level); err != nil {
+		h.lgr.Error().Err(err).Msg("failed to revert log level")
+		return
+	}
+	h.levelOverride = levelOverride{change: change}
+
+	h.lgr.Warn().Str("to", level).Msg("log level reverted")
+}
+
+// ResetLogLevel drops a level set through SetLogLevel and goes back to the
+// configured one. A config reload calls it.
+func (h *Handler) ResetLogLevel() error {
+	h.levelMu.Lock()
+	defer h.levelMu.Unlock()
+
+	if h.levelOverride.timer != nil {
+		h.levelOverride.timer.Stop()
+	}
+	// A timer that already fired waits for levelMu and sees a later change.
+	h.levelOverride = levelOverride{change: h.levelOverride.change + 1}
+
+	_, err := logger.SetLevel(h.cfg.Load().LogLevel)
+	return err
+}
+
+func (h *Handler) writeLogLevel(w http.ResponseWriter) {
+	resp := LogLevelResp{Level: zerolog.GlobalLevel().String()}
+	if h.levelOverride.timer != nil {
+		resp.RevertAt = &h.levelOverride.revertAt
+	}
+
+	body, _ := json.Marshal(resp)
+	fmt.Fprint(w, string(body))
+}
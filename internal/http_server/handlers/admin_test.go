@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"crud/internal/config"
+	"crud/internal/http_server"
+	"crud/internal/http_server/handlers"
+	"crud/internal/storage"
+	"crud/pkg/metrics"
+	"crud/pkg/tracing"
+	"github.com/rs/zerolog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResetLogLevelDuringOverride(t *testing.T) {
+	previous := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(previous) })
+
+	cfg := config.Default()
+	cfg.Database.Name = "memory"
+	cfg.Admin.Token = "admin"
+	snapshot := config.NewSnapshot(cfg)
+	reg := metrics.NewRegistry()
+	tracer := tracing.NewTracer("crud", nil, 1, nil)
+	stor := storage.NewStorage(snapshot, zerolog.Nop(), reg, tracer)
+	handler := handlers.NewHandler(snapshot, zerolog.Nop(), stor, reg, tracer, nil)
+	srv := http_server.NewRouter(handler)
+
+	w := do(srv, "PUT", "/admin/log-level", `{"level": "debug", "revert_after": "50ms"}`, "Authorization", "Bearer admin")
+	assertStatus(t, w, http.StatusOK)
+	var resp handlers.LogLevelResp
+	decode(t, w, &resp)
+	if resp.Level != "debug" || resp.RevertAt == nil {
+		t.Fatalf("got %+v, want debug with revert_at", resp)
+	}
+
+	// The reloaded config sets another level.
+	next := *cfg
+	next.LogLevel = "warn"
+	snapshot.Apply(&next)
+	if err := handler.ResetLogLevel(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = handlers.LogLevelResp{}
+	decode(t, do(srv, "GET", "/admin/log-level", "", "Authorization", "Bearer admin"), &resp)
+	if resp.Level != "warn" || resp.RevertAt != nil {
+		t.Errorf("got %+v after the reload, want warn without revert_at", resp)
+	}
+
+	// The timer of the dropped override does nothing.
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+	time.Sleep(100 * time.Millisecond)
+	if level := zerolog.GlobalLevel(); level != zerolog.ErrorLevel {
+		t.Errorf("got level %s after the old revert time", level)
+	}
+}
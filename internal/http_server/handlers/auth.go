@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"crud/internal/auth"
+	"crud/internal/constants"
+	"crud/internal/requestid"
+	"crud/pkg/tracing"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// Authenticate lets handle through only requests with valid credentials,
+// and puts their principal in the request context. It lets everything
+// through when authentication is disabled.
+func (h *Handler) Authenticate(handle httprouter.Handle) httprouter.Handle {
+	if h.authn == nil {
+		return handle
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx := r.Context()
+
+		principal, err := h.authn.Authenticate(r)
+		if err != nil {
+			h.lgr.Debug().
+				Str("handler", "Authenticate").
+				Str(constants.RequestIdKey, requestid.FromContext(ctx)).
+				EmbedObject(tracing.FromContext(ctx)).
+				Err(err).
+				Msg("unauthenticated")
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="crud"`)
+			msg := "authentication required"
+			if errors.Is(err, auth.ErrInvalid) {
+				msg = "invalid credentials"
+			}
+			writeError(w, http.StatusUnauthorized, msg)
+			return
+		}
+
+		if record, ok := ctx.Value(accessKey{}).(*accessRecord); ok {
+			record.principal = principal.Subject
+		}
+		if span := tracing.SpanFromContext(ctx); span != nil {
+			span.SetAttr("enduser.id", principal.Subject)
+		}
+		handle(w, r.WithContext(auth.NewContext(ctx, principal)), ps)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"crud/internal/storage/errs"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag renders a version as a strong entity tag. Versions are counted per
+// row, so a tag only means something together with the resource URL.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// entityTags splits an If-Match or If-None-Match list. any is set for "*".
+func entityTags(header string) (tags []string, any bool) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, false
+}
+
+// expectedVersion turns If-Match into the version a compare-and-swap write
+// must find, zero when the request is unconditional. Storage compares with a
+// single version, so a list of several is resolved against the current one,
+// which current fetches. Weak tags never pass the strong comparison If-Match
+// requires.
+func expectedVersion(r *http.Request, current func() (uint64, error)) (uint64, error) {
+	header := r.Header.Get("If-Match")
+	tags, any := entityTags(header)
+	if header == "" || any {
+		return 0, nil
+	}
+
+	versions := make([]uint64, 0, len(tags))
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+		if err == nil && version != 0 {
+			versions = append(versions, version)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+	case 1:
+		return versions[0], nil
+	default:
+		version, err := current()
+		if err != nil {
+			return 0, err
+		}
+		for _, v := range versions {
+			if v == version {
+				return version, nil
+			}
+		}
+	}
+
+	return 0, errs.New(errs.ErrPrecondition, "If-Match doesn't list the current version")
+}
+
+// notModified reports whether If-None-Match lists the current version. GET
+// uses the weak comparison, so W/ prefixes don't matter.
+func notModified(r *http.Request, version uint64) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	tags, any := entityTags(header)
+	if any {
+		return true
+	}
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "W/") == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) authorVersion(ctx context.Context, id uint64) func() (uint64, error) {
+	return func() (uint64, error) {
+		author, err := h.authors.Get(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		return author.Version, nil
+	}
+}
+
+func (h *Handler) postVersion(ctx context.Context, id uint64) func() (uint64, error) {
+	return func() (uint64, error) {
+		post, err := h.posts.Get(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		return post.Version, nil
+	}
+}
@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+// versioned returns a server with author 1 and post 1 at version 2.
+func versioned(t *testing.T) http.Handler {
+	t.Helper()
+	srv := server(t, nil)
+	assertStatus(t, do(srv, "POST", "/authors", `{"name": "alice"}`), http.StatusCreated)
+	assertStatus(t, do(srv, "PATCH", "/authors/1", `{"name": "alice b"}`), http.StatusOK)
+	assertStatus(t, do(srv, "POST", "/posts", `{"author_id": 1, "title": "t", "content": "c"}`), http.StatusCreated)
+	assertStatus(t, do(srv, "PATCH", "/posts/1", `{"title": "u"}`), http.StatusOK)
+	return srv
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		status int
+	}{
+		{"", http.StatusOK},
+		{`"2"`, http.StatusNotModified},
+		{`W/"2"`, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"1", "2"`, http.StatusNotModified},
+		{`"1"`, http.StatusOK},
+		{`W/"1"`, http.StatusOK},
+		{`2`, http.StatusOK},
+	} {
+		for _, target := range []string{"/authors/1", "/posts/1"} {
+			t.Run(target+" "+c.header, func(t *testing.T) {
+				srv := versioned(t)
+				w := do(srv, "GET", target, "", "If-None-Match", c.header)
+				assertStatus(t, w, c.status)
+				if etag := w.Header().Get("ETag"); etag != `"2"` {
+					t.Errorf("got ETag %s, want \"2\"", etag)
+				}
+				if c.status == http.StatusNotModified && w.Body.Len() != 0 {
+					t.Errorf("got a body with 304: %s", w.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	writes := []struct{ method, target, body string }{
+		{"PUT", "/authors/1", `{"name": "bob"}`},
+		{"PATCH", "/authors/1", `{"name": "bob"}`},
+		{"PUT", "/posts/1", `{"author_id": 1, "title": "v", "content": "c", "created_at": "2022-01-01T00:00:00Z"}`},
+		{"PATCH", "/posts/1", `{"title": "v"}`},
+		{"DELETE", "/posts/1", ""},
+	}
+
+	for _, c := range []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing is unconditional", "", http.StatusOK},
+		{"current", `"2"`, http.StatusOK},
+		{"any", "*", http.StatusOK},
+		{"list with the current", `"1", "2"`, http.StatusOK},
+		{"stale", `"1"`, http.StatusPreconditionFailed},
+		{"list without the current", `"1", "3"`, http.StatusPreconditionFailed},
+		{"weak never matches", `W/"2"`, http.StatusPreconditionFailed},
+		{"unquoted", `2`, http.StatusPreconditionFailed},
+		{"zero", `"0"`, http.StatusPreconditionFailed},
+	} {
+		for _, write := range writes {
+			t.Run(c.name+" "+write.method+" "+write.target, func(t *testing.T) {
+				srv := versioned(t)
+				w := do(srv, write.method, write.target, write.body, "If-Match", c.header)
+				assertStatus(t, w, c.status)
+
+				if write.method == "DELETE" {
+					return
+				}
+				want := `"3"`
+				if c.status != http.StatusOK {
+					want = `"2"`
+				}
+				if etag := do(srv, "GET", write.target, "").Header().Get("ETag"); etag != want {
+					t.Errorf("got ETag %s after the write, want %s", etag, want)
+				}
+			})
+		}
+	}
+}
+
+func TestIfMatchMissingResource(t *testing.T) {
+	srv := versioned(t)
+	// A list is resolved against the current version, which doesn't exist.
+	w := do(srv, "PUT", "/authors/9", `{"name": "bob"}`, "If-Match", `"1", "2"`)
+	assertStatus(t, w, http.StatusNotFound)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crud/internal/config"
+	"crud/internal/constants"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alwaysExposed are readable by scripts whatever the config says.
+var alwaysExposed = []string{constants.RequestIdKey, "ETag"}
+
+// allowOrigin returns the Access-Control-Allow-Origin of origin, or "" if it
+// is not allowed.
+func allowOrigin(cfg config.CORSConfig, origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, pattern := range cfg.AllowedOrigins {
+		switch {
+		case pattern == "*":
+			if cfg.AllowCredentials {
+				return origin
+			}
+			return "*"
+		case strings.EqualFold(pattern, origin):
+			return origin
+		case matchSubdomain(pattern, origin):
+			return origin
+		}
+	}
+	return ""
+}
+
+// matchSubdomain tells whether origin is a subdomain matched by a pattern
+// such as "https://*.example.com".
+func matchSubdomain(pattern, origin string) bool {
+	scheme, suffix, ok := strings.Cut(strings.ToLower(pattern), "://*")
+	if !ok {
+		return false
+	}
+	sub := strings.TrimPrefix(strings.ToLower(origin), scheme+"://")
+	if len(sub) == len(origin) || !strings.HasSuffix(sub, suffix) {
+		return false
+	}
+	sub = strings.TrimSuffix(sub, suffix)
+	return sub != "" && !strings.ContainsAny(sub, ":/@")
+}
+
+// isPreflight tells whether r asks what a cross-origin request may do.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// CORS adds the CORS headers of responses to allowed origins. Preflight
+// requests are answered by Preflight.
+func (h *Handler) CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.cfg.Load().HttpServer.CORS
+		if len(cfg.AllowedOrigins) == 0 || isPreflight(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		if allowed := allowOrigin(cfg, r.Header.Get("Origin")); allowed != "" {
+			header.Set("Access-Control-Allow-Origin", allowed)
+			if cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			exposed := append(append([]string(nil), alwaysExposed...), cfg.ExposedHeaders...)
+			header.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Preflight answers the OPTIONS requests of every route, it is the
+// GlobalOPTIONS of the router, which sets Allow to the methods of the path
+// beforehand. A preflight request asking for something not allowed gets no
+// CORS headers, which browsers take as a refusal.
+func (h *Handler) Preflight(w http.ResponseWriter, r *http.Request) {
+	cfg := h.cfg.Load().HttpServer.CORS
+	header := w.Header()
+	if len(cfg.AllowedOrigins) == 0 || !isPreflight(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	allowed := allowOrigin(cfg, r.Header.Get("Origin"))
+	methods := preflightMethods(cfg.AllowedMethods, header.Get("Allow"))
+	method := r.Header.Get("Access-Control-Request-Method")
+	headers, headersOk := preflightHeaders(cfg.AllowedHeaders, r.Header.Values("Access-Control-Request-Headers"))
+	if allowed == "" || !contains(methods, method) || !headersOk {
+		h.lgr.Debug().
+			Str("handler", "Preflight").
+			Str("origin", r.Header.Get("Origin")).
+			Str("method", method).
+			Strs("headers", headers).
+			Msg("cross-origin request refused")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if cfg.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(cfg.MaxAge).Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// preflightMethods are the allowed methods that the path has.
+func preflightMethods(allowedMethods []string, allow string) []string {
+	var methods []string
+	for _, method := range strings.Split(allow, ",") {
+		method = strings.TrimSpace(method)
+		if method != http.MethodOptions && contains(allowedMethods, method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// preflightHeaders returns the requested headers, and whether they are all
+// allowed.
+func preflightHeaders(allowedHeaders []string, requested []string) ([]string, bool) {
+	var headers []string
+	ok := true
+	for _, name := range strings.Split(strings.Join(requested, ","), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		headers = append(headers, name)
+		ok = ok && containsFold(allowedHeaders, name)
+	}
+	return headers, ok
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"crud/pkg/validate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var errTrailingData = errors.New("unexpected data after the JSON object")
+
+// decodeRequest reads exactly one JSON object into v, rejecting unknown fields
+// and anything that follows it, and then applies its validate rules.
+func decodeRequest(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+
+	return validate.Struct(v)
+}
+
+// requestError answers 422 with every offending field when validation failed,
+// the status of a PATCH document that can't be applied, and 400 when the body
+// could not be decoded at all.
+func requestError(w http.ResponseWriter, err error) {
+	var pe *patchError
+	if errors.As(err, &pe) {
+		writeError(w, pe.status, pe.msg)
+		return
+	}
+
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		resp, _ := json.Marshal(ValidationErrorResp{Error: "validation failed", Fields: fieldErrs})
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, string(resp))
+		return
+	}
+
+	writeError(w, http.StatusBadRequest, fmt.Sprintf("incorrect request: %s", err.Error()))
+}
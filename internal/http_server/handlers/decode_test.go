@@ -0,0 +1,66 @@
+package handlers_test
+
+import (
+	"crud/internal/http_server/handlers"
+	"crud/pkg/validate"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRejected(t *testing.T) {
+	srv := server(t, nil)
+	assertStatus(t, do(srv, "POST", "/authors", `{"name": "alice"}`), http.StatusCreated)
+
+	for _, c := range []struct {
+		name                 string
+		method, target, body string
+		want                 string
+	}{
+		{"unknown field", "POST", "/authors", `{"name": "bob", "age": 3}`,
+			`{"error":"incorrect request: json: unknown field \"age\""}`},
+		{"unknown field in an update", "PUT", "/authors/1", `{"name": "bob", "id": 1}`,
+			`{"error":"incorrect request: json: unknown field \"id\""}`},
+		{"trailing object", "POST", "/authors", `{"name": "bob"}{"name": "eve"}`,
+			`{"error":"incorrect request: unexpected data after the JSON object"}`},
+		{"trailing garbage", "POST", "/posts", `{"author_id": 1, "title": "t", "content": "c"} x`,
+			`{"error":"incorrect request: unexpected data after the JSON object"}`},
+		{"empty body", "POST", "/authors", ``,
+			`{"error":"incorrect request: EOF"}`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			w := do(srv, c.method, c.target, c.body)
+			assertStatus(t, w, http.StatusBadRequest)
+			if got := w.Body.String(); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+
+	// Nothing was written by the rejected requests.
+	var authors handlers.ListAuthorsResp
+	decode(t, do(srv, "GET", "/authors", ""), &authors)
+	if len(authors.Authors) != 1 || authors.Authors[0].Name != "alice" {
+		t.Errorf("got %+v", authors.Authors)
+	}
+}
+
+func TestDecodeValidation(t *testing.T) {
+	srv := server(t, nil)
+
+	w := do(srv, "POST", "/posts", `{"author_id": 0, "title": " ", "content": "c", "created_at": "1999-01-01T00:00:00Z"}`)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+	var resp handlers.ValidationErrorResp
+	decode(t, w, &resp)
+	want := handlers.ValidationErrorResp{
+		Error: "validation failed",
+		Fields: []validate.FieldError{
+			{Field: "author_id", Rule: "required", Message: "is required"},
+			{Field: "title", Rule: "required", Message: "is required"},
+			{Field: "created_at", Rule: "min=2000-01-01T00:00:00Z", Message: "must not be before 2000-01-01T00:00:00Z"},
+		},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+}
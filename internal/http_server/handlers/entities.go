@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"crud/internal/config"
 	"crud/internal/entities"
+	"crud/pkg/validate"
 	"time"
 )
 
@@ -9,32 +11,80 @@ type ErrorResp struct {
 	Error string `json:"error"`
 }
 
+type ValidationErrorResp struct {
+	Error  string                `json:"error"`
+	Fields []validate.FieldError `json:"fields"`
+}
+
 type AddAuthorReq struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=200"`
 }
 
 type ListAuthorsResp struct {
-	Authors []entities.Author `json:"authors"`
+	Authors    []entities.Author `json:"authors"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+type GetAuthorResp struct {
+	Author entities.Author `json:"author"`
 }
 
 type UpdateAuthorReq struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=200"`
 }
 
 type AddPostReq struct {
-	AuthorId  uint64    `json:"author_id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	AuthorId  uint64    `json:"author_id" validate:"required"`
+	Title     string    `json:"title" validate:"required,max=300"`
+	Content   string    `json:"content" validate:"required,max=100000"`
+	CreatedAt time.Time `json:"created_at" validate:"default=now,min=2000-01-01T00:00:00Z,max=now+1h"`
 }
 
 type ListPostsResp struct {
-	Posts []entities.Post `json:"posts"`
+	Posts      []entities.Post `json:"posts"`
+	NextCursor string          `json:"next_cursor"`
 }
 
+type GetPostResp struct {
+	Post entities.Post `json:"post"`
+}
+
+// UpdatePostReq replaces the whole post, so unlike AddPostReq every field is
+// required.
 type UpdatePostReq struct {
-	AuthorId  uint64    `json:"author_id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	AuthorId  uint64    `json:"author_id" validate:"required"`
+	Title     string    `json:"title" validate:"required,max=300"`
+	Content   string    `json:"content" validate:"required,max=100000"`
+	CreatedAt time.Time `json:"created_at" validate:"required,min=2000-01-01T00:00:00Z,max=now+1h"`
+}
+
+// PatchAuthorReq and PatchPostReq hold the members a PATCH changes. Absent
+// members stay nil and are left as they are.
+type PatchAuthorReq struct {
+	Name *string `json:"name" validate:"required,max=200"`
+}
+
+type PatchPostReq struct {
+	AuthorId  *uint64    `json:"author_id" validate:"required"`
+	Title     *string    `json:"title" validate:"required,max=300"`
+	Content   *string    `json:"content" validate:"required,max=100000"`
+	CreatedAt *time.Time `json:"created_at" validate:"required,min=2000-01-01T00:00:00Z,max=now+1h"`
+}
+
+// HealthResp has the status of every check, "ok" or "failed".
+type HealthResp struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// LogLevelReq sets the log level, back to the configured one after
+// RevertAfter if it is set.
+type LogLevelReq struct {
+	Level       string          `json:"level" validate:"required"`
+	RevertAfter config.Duration `json:"revert_after"`
+}
+
+type LogLevelResp struct {
+	Level    string     `json:"level"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
 }
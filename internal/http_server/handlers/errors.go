@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"crud/internal/storage"
+	"crud/internal/storage/errs"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/http"
+)
+
+// storageStatuses maps storage error kinds to response codes. Anything else
+// is reported as a 500 without the driver message.
+var storageStatuses = []struct {
+	kind   error
+	status int
+}{
+	{storage.ErrNotFound, http.StatusNotFound},
+	{storage.ErrConflict, http.StatusConflict},
+	{storage.ErrForeignKey, http.StatusUnprocessableEntity},
+	{storage.ErrInvalid, http.StatusUnprocessableEntity},
+	{storage.ErrUnavailable, http.StatusServiceUnavailable},
+	{storage.ErrPrecondition, http.StatusPreconditionFailed},
+	{storage.ErrForbidden, http.StatusForbidden},
+}
+
+func (h *Handler) storageError(w http.ResponseWriter, lgr zerolog.Logger, err error) {
+	for _, s := range storageStatuses {
+		if errors.Is(err, s.kind) {
+			lgr.Debug().Err(err).Int("status", s.status).Msg("storage error")
+			writeError(w, s.status, errs.Message(err))
+			return
+		}
+	}
+
+	lgr.Error().Err(err).Msg("storage failed")
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	resp, _ := json.Marshal(ErrorResp{Error: msg})
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(resp))
+}
@@ -1,44 +1,93 @@
 package handlers
 
 import (
+	"crud/internal/auth"
+	"crud/internal/authz"
 	"crud/internal/config"
 	"crud/internal/constants"
 	"crud/internal/entities"
 	"crud/internal/storage"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/metrics"
+	"crud/pkg/ratelimit"
+	"crud/pkg/tracing"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog"
 	"net/http"
+	"regexp"
 	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
 type Handler struct {
-	cfg     *config.Config
+	cfg     *config.Snapshot
 	lgr     zerolog.Logger
+	stor    *storage.Storage
 	authors storage.IAuthors
 	posts   storage.IPosts
+
+	registry *metrics.Registry
+	metrics  httpMetrics
+	tracer   *tracing.Tracer
+	// authn is nil when authentication is disabled.
+	authn auth.Authenticator
+
+	// requestIdPattern accepts incoming request ids, nil rejects them all.
+	requestIdPattern *regexp.Regexp
+
+	draining atomic.Bool
+
+	// levelMu guards levelOverride and changes of the log level made
+	// through the admin endpoint.
+	levelMu       sync.Mutex
+	levelOverride levelOverride
+
+	limiter  *ratelimit.Limiter
+	limits   atomic.Pointer[limits]
+	inFlight atomic.Int64
 }
 
-func NewHandler(cfg *config.Config, lgr zerolog.Logger, stor *storage.Storage) *Handler {
-	return &Handler{
-		cfg:     cfg,
-		lgr:     lgr,
-		authors: stor.Authors,
-		posts:   stor.Posts,
+func NewHandler(cfg *config.Snapshot, lgr zerolog.Logger, stor *storage.Storage, reg *metrics.Registry,
+	tracer *tracing.Tracer, authn auth.Authenticator) *Handler {
+	var requestIdPattern *regexp.Regexp
+	if pattern := cfg.Load().HttpServer.RequestIdPattern; pattern != "" {
+		requestIdPattern = regexp.MustCompile(pattern)
+	}
+
+	h := &Handler{
+		cfg:      cfg,
+		lgr:      lgr,
+		stor:     stor,
+		authors:  authz.NewAuthors(stor.Authors),
+		posts:    authz.NewPosts(stor.Posts),
+		registry: reg,
+		metrics:  newHTTPMetrics(reg),
+		tracer:   tracer,
+		authn:    authn,
+
+		requestIdPattern: requestIdPattern,
+		limiter:          ratelimit.New(),
 	}
+	reg.GaugeFunc("http_requests_in_flight", "API requests being handled.",
+		func(emit func(float64, ...string)) {
+			emit(float64(h.inFlight.Load()))
+		})
+	return h
 }
 
 func (h *Handler) AddAuthor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
 	request := new(AddAuthorReq)
-	err := decoder.Decode(request)
+	err := decodeRequest(r.Body, request)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect request: %s", err.Error())})
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, string(resp))
+		requestError(w, err)
 		return
 	}
 
@@ -48,20 +97,22 @@ func (h *Handler) AddAuthor(w http.ResponseWriter, r *http.Request, ps httproute
 	lgr := h.lgr.With().
 		Str("handler", "AddAuthor").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Str("name", request.Name)).
 		Logger()
 
-	err = h.authors.Add(ctx, &entities.Author{Name: request.Name})
+	author := &entities.Author{Name: request.Name}
+	err = h.authors.Add(ctx, author)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, string(resp))
+		h.storageError(w, lgr, err)
 		return
 	}
 
 	lgr.Debug().Msg("executed")
 
+	w.Header().Set("ETag", etag(author.Version))
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -72,45 +123,144 @@ func (h *Handler) ListAuthors(w http.ResponseWriter, r *http.Request, ps httprou
 	lgr := h.lgr.With().
 		Str("handler", "ListAuthors").
 		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
 		Logger()
 
-	listAuthors, err := h.authors.List(ctx)
+	opts, err := parseListOptions(r.URL.Query(), query.AuthorSortFields, false)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
+		resp, _ := json.Marshal(ErrorResp{Error: err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, string(resp))
 		return
 	}
 
+	lgr = lgr.With().Object("query", listFields(opts)).Logger()
+
+	listAuthors, next, err := h.authors.List(ctx, opts)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
 	lgr.Debug().Msg("executed")
 
-	resp, _ := json.Marshal(ListAuthorsResp{Authors: listAuthors})
+	resp, _ := json.Marshal(ListAuthorsResp{Authors: listAuthors, NextCursor: next})
+	fmt.Fprintf(w, string(resp))
+}
+
+func (h *Handler) GetAuthor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+
+	idStr := ps.ByName("id")
+	lgr := h.lgr.With().
+		Str("handler", "GetAuthor").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr)).
+		Logger()
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect id: %s", idStr)})
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, string(resp))
+		return
+	}
+
+	author, err := h.authors.Get(ctx, id)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(author.Version))
+	if notModified(r, author.Version) {
+		lgr.Debug().Msg("not modified")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	lgr.Debug().Msg("executed")
+
+	resp, _ := json.Marshal(GetAuthorResp{Author: *author})
 	fmt.Fprintf(w, string(resp))
 }
 
 func (h *Handler) UpdateAuthor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
 	request := new(UpdateAuthorReq)
-	err := decoder.Decode(request)
+	err := decodeRequest(r.Body, request)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect request: %s", err.Error())})
+		requestError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+
+	idStr := ps.ByName("id")
+	lgr := h.lgr.With().
+		Str("handler", "UpdateAuthor").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr).
+			Str("name", request.Name).
+			Str("if_match", r.Header.Get("If-Match"))).
+		Logger()
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect id: %s", idStr)})
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, string(resp))
 		return
 	}
 
+	version, err := expectedVersion(r, h.authorVersion(ctx, id))
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	author := &entities.Author{
+		Id:      id,
+		Name:    request.Name,
+		Version: version,
+	}
+	err = h.authors.Update(ctx, author)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	lgr.Debug().Msg("executed")
+
+	w.Header().Set("ETag", etag(author.Version))
+}
+
+func (h *Handler) PatchAuthor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer r.Body.Close()
+
 	ctx := r.Context()
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 
 	idStr := ps.ByName("id")
 	lgr := h.lgr.With().
-		Str("handler", "UpdateAuthor").
+		Str("handler", "PatchAuthor").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Str("id", idStr).
-			Str("name", request.Name)).
+			Str("content_type", r.Header.Get("Content-Type")).
+			Str("if_match", r.Header.Get("If-Match"))).
 		Logger()
 
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -121,18 +271,65 @@ func (h *Handler) UpdateAuthor(w http.ResponseWriter, r *http.Request, ps httpro
 		return
 	}
 
-	err = h.authors.Update(ctx, &entities.Author{
-		Id:   id,
-		Name: request.Name,
+	version, err := expectedVersion(r, h.authorVersion(ctx, id))
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	// A JSON Patch is computed from the current author, so it must not be
+	// written over a newer one even when the client set no precondition.
+	var (
+		getErr      error
+		baseVersion uint64
+	)
+	members, err := readPatch(r, func() (interface{}, error) {
+		author, err := h.authors.Get(ctx, id)
+		if err != nil {
+			getErr = err
+			return nil, err
+		}
+		baseVersion = author.Version
+		return author, nil
 	})
+	if getErr != nil {
+		h.storageError(w, lgr, getErr)
+		return
+	}
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, string(resp))
+		requestError(w, err)
+		return
+	}
+
+	request := new(PatchAuthorReq)
+	if err = decodePatch(members, request); err != nil {
+		requestError(w, err)
+		return
+	}
+
+	patch := &entities.AuthorPatch{Name: request.Name}
+	lgr = lgr.With().Strs("fields", patch.Fields()).Logger()
+
+	conditional := version != 0
+	if !conditional {
+		version = baseVersion
+	}
+
+	author, err := h.authors.Patch(ctx, id, version, patch)
+	if errors.Is(err, storage.ErrPrecondition) && !conditional {
+		err = errs.Wrap(errs.ErrConflict, "author was modified concurrently, retry the request", err)
+	}
+	if err != nil {
+		h.storageError(w, lgr, err)
 		return
 	}
 
 	lgr.Debug().Msg("executed")
+
+	w.Header().Set("ETag", etag(author.Version))
+
+	resp, _ := json.Marshal(GetAuthorResp{Author: *author})
+	fmt.Fprintf(w, string(resp))
 }
 
 func (h *Handler) DeleteAuthor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -143,8 +340,11 @@ func (h *Handler) DeleteAuthor(w http.ResponseWriter, r *http.Request, ps httpro
 	lgr := h.lgr.With().
 		Str("handler", "DeleteAuthor").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
-			Str("id", idStr)).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr).
+			Str("if_match", r.Header.Get("If-Match"))).
 		Logger()
 
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -155,11 +355,15 @@ func (h *Handler) DeleteAuthor(w http.ResponseWriter, r *http.Request, ps httpro
 		return
 	}
 
-	err = h.authors.Delete(ctx, id)
+	version, err := expectedVersion(r, h.authorVersion(ctx, id))
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, string(resp))
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	err = h.authors.Delete(ctx, id, version)
+	if err != nil {
+		h.storageError(w, lgr, err)
 		return
 	}
 
@@ -167,15 +371,12 @@ func (h *Handler) DeleteAuthor(w http.ResponseWriter, r *http.Request, ps httpro
 }
 
 func (h *Handler) AddPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
 	request := new(AddPostReq)
-	err := decoder.Decode(request)
+	err := decodeRequest(r.Body, request)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect request: %s", err.Error())})
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, string(resp))
+		requestError(w, err)
 		return
 	}
 
@@ -185,28 +386,30 @@ func (h *Handler) AddPost(w http.ResponseWriter, r *http.Request, ps httprouter.
 	lgr := h.lgr.With().
 		Str("handler", "AddPost").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("author_id", request.AuthorId).
 			Str("title", request.Title).
 			Str("content", request.Content).
 			Time("created_at", request.CreatedAt)).
 		Logger()
 
-	err = h.posts.Add(ctx, &entities.Post{
+	post := &entities.Post{
 		AuthorId:  request.AuthorId,
 		Title:     request.Title,
 		Content:   request.Content,
 		CreatedAt: request.CreatedAt,
-	})
+	}
+	err = h.posts.Add(ctx, post)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, string(resp))
+		h.storageError(w, lgr, err)
 		return
 	}
 
 	lgr.Debug().Msg("executed")
 
+	w.Header().Set("ETag", etag(post.Version))
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -217,32 +420,132 @@ func (h *Handler) ListPosts(w http.ResponseWriter, r *http.Request, ps httproute
 	lgr := h.lgr.With().
 		Str("handler", "ListPosts").
 		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
 		Logger()
 
-	listPosts, err := h.posts.List(ctx)
+	opts, err := parseListOptions(r.URL.Query(), query.PostSortFields, true)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
+		resp, _ := json.Marshal(ErrorResp{Error: err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, string(resp))
 		return
 	}
 
+	lgr = lgr.With().Object("query", listFields(opts)).Logger()
+
+	listPosts, next, err := h.posts.List(ctx, opts)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
 	lgr.Debug().Msg("executed")
 
-	resp, _ := json.Marshal(ListPostsResp{Posts: listPosts})
+	resp, _ := json.Marshal(ListPostsResp{Posts: listPosts, NextCursor: next})
+	fmt.Fprintf(w, string(resp))
+}
+
+func (h *Handler) GetPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+
+	idStr := ps.ByName("id")
+	lgr := h.lgr.With().
+		Str("handler", "GetPost").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr)).
+		Logger()
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect id: %s", idStr)})
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, string(resp))
+		return
+	}
+
+	post, err := h.posts.Get(ctx, id)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(post.Version))
+	if notModified(r, post.Version) {
+		lgr.Debug().Msg("not modified")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	lgr.Debug().Msg("executed")
+
+	resp, _ := json.Marshal(GetPostResp{Post: *post})
+	fmt.Fprintf(w, string(resp))
+}
+
+func (h *Handler) ListAuthorPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx := r.Context()
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+
+	idStr := ps.ByName("id")
+	lgr := h.lgr.With().
+		Str("handler", "ListAuthorPosts").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr)).
+		Logger()
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect id: %s", idStr)})
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, string(resp))
+		return
+	}
+
+	opts, err := parseListOptions(r.URL.Query(), query.PostSortFields, true)
+	if err != nil {
+		resp, _ := json.Marshal(ErrorResp{Error: err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, string(resp))
+		return
+	}
+
+	lgr = lgr.With().Object("query", listFields(opts)).Logger()
+	opts.Filter.AuthorId = id
+
+	// An unknown author is a 404 rather than an empty list.
+	_, err = h.authors.Get(ctx, id)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	listPosts, next, err := h.posts.List(ctx, opts)
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	lgr.Debug().Msg("executed")
+
+	resp, _ := json.Marshal(ListPostsResp{Posts: listPosts, NextCursor: next})
 	fmt.Fprintf(w, string(resp))
 }
 
 func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
 	request := new(UpdatePostReq)
-	err := decoder.Decode(request)
+	err := decodeRequest(r.Body, request)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect request: %s", err.Error())})
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, string(resp))
+		requestError(w, err)
 		return
 	}
 
@@ -253,12 +556,15 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request, ps httprout
 	lgr := h.lgr.With().
 		Str("handler", "UpdatePost").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Str("id", idStr).
 			Uint64("author_id", request.AuthorId).
 			Str("title", request.Title).
 			Str("content", request.Content).
-			Time("created_at", request.CreatedAt)).
+			Time("created_at", request.CreatedAt).
+			Str("if_match", r.Header.Get("If-Match"))).
 		Logger()
 
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -269,21 +575,121 @@ func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	err = h.posts.Update(ctx, &entities.Post{
+	version, err := expectedVersion(r, h.postVersion(ctx, id))
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	post := &entities.Post{
 		Id:        id,
 		AuthorId:  request.AuthorId,
 		Title:     request.Title,
 		Content:   request.Content,
 		CreatedAt: request.CreatedAt,
-	})
+		Version:   version,
+	}
+	err = h.posts.Update(ctx, post)
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	lgr.Debug().Msg("executed")
+
+	w.Header().Set("ETag", etag(post.Version))
+}
+
+func (h *Handler) PatchPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	defer r.Body.Close()
+
+	ctx := r.Context()
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+
+	idStr := ps.ByName("id")
+	lgr := h.lgr.With().
+		Str("handler", "PatchPost").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr).
+			Str("content_type", r.Header.Get("Content-Type")).
+			Str("if_match", r.Header.Get("If-Match"))).
+		Logger()
+
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("incorrect id: %s", idStr)})
+		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, string(resp))
 		return
 	}
 
+	version, err := expectedVersion(r, h.postVersion(ctx, id))
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	// A JSON Patch is computed from the current post, so it must not be
+	// written over a newer one even when the client set no precondition.
+	var (
+		getErr      error
+		baseVersion uint64
+	)
+	members, err := readPatch(r, func() (interface{}, error) {
+		post, err := h.posts.Get(ctx, id)
+		if err != nil {
+			getErr = err
+			return nil, err
+		}
+		baseVersion = post.Version
+		return post, nil
+	})
+	if getErr != nil {
+		h.storageError(w, lgr, getErr)
+		return
+	}
+	if err != nil {
+		requestError(w, err)
+		return
+	}
+
+	request := new(PatchPostReq)
+	if err = decodePatch(members, request); err != nil {
+		requestError(w, err)
+		return
+	}
+
+	patch := &entities.PostPatch{
+		AuthorId:  request.AuthorId,
+		Title:     request.Title,
+		Content:   request.Content,
+		CreatedAt: request.CreatedAt,
+	}
+	lgr = lgr.With().Strs("fields", patch.Fields()).Logger()
+
+	conditional := version != 0
+	if !conditional {
+		version = baseVersion
+	}
+
+	post, err := h.posts.Patch(ctx, id, version, patch)
+	if errors.Is(err, storage.ErrPrecondition) && !conditional {
+		err = errs.Wrap(errs.ErrConflict, "post was modified concurrently, retry the request", err)
+	}
+	if err != nil {
+		h.storageError(w, lgr, err)
+		return
+	}
+
 	lgr.Debug().Msg("executed")
+
+	w.Header().Set("ETag", etag(post.Version))
+
+	resp, _ := json.Marshal(GetPostResp{Post: *post})
+	fmt.Fprintf(w, string(resp))
 }
 
 func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -294,8 +700,11 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request, ps httprout
 	lgr := h.lgr.With().
 		Str("handler", "DeletePost").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
-			Str("id", idStr)).
+		EmbedObject(tracing.FromContext(ctx)).
+		EmbedObject(auth.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("id", idStr).
+			Str("if_match", r.Header.Get("If-Match"))).
 		Logger()
 
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -306,11 +715,15 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	err = h.posts.Delete(ctx, id)
+	version, err := expectedVersion(r, h.postVersion(ctx, id))
 	if err != nil {
-		resp, _ := json.Marshal(ErrorResp{Error: fmt.Sprintf("internal error: %s", err.Error())})
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, string(resp))
+		h.storageError(w, lgr, err)
+		return
+	}
+
+	err = h.posts.Delete(ctx, id, version)
+	if err != nil {
+		h.storageError(w, lgr, err)
 		return
 	}
 
@@ -0,0 +1,238 @@
+package handlers_test
+
+import (
+	"context"
+	"crud/internal/auth"
+	"crud/internal/config"
+	"crud/internal/entities"
+	"crud/internal/http_server"
+	"crud/internal/http_server/handlers"
+	"crud/internal/storage"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/metrics"
+	"crud/pkg/tracing"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// server serves every route over the memory backend, or over stor if given.
+func server(t *testing.T, stor *storage.Storage) http.Handler {
+	t.Helper()
+	return serverWith(t, config.Default(), stor, nil)
+}
+
+// serverWith is server with another config, and authentication by authn
+// unless it is nil.
+func serverWith(t *testing.T, cfg *config.Config, stor *storage.Storage, authn auth.Authenticator) http.Handler {
+	t.Helper()
+	cfg.Database.Name = "memory"
+	snapshot := config.NewSnapshot(cfg)
+	reg := metrics.NewRegistry()
+	tracer := tracing.NewTracer("crud", nil, 1, nil)
+	if stor == nil {
+		stor = storage.NewStorage(snapshot, zerolog.Nop(), reg, tracer)
+	}
+	return http_server.NewRouter(handlers.NewHandler(snapshot, zerolog.Nop(), stor, reg, tracer, authn))
+}
+
+// do sends a request to srv. headers are name and value pairs.
+func do(srv http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w
+}
+
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got %d %s, want %d", w.Code, w.Body, status)
+	}
+}
+
+// assertError checks the status and that the body is an ErrorResp whose
+// message contains msg.
+func assertError(t *testing.T, w *httptest.ResponseRecorder, status int, msg string) {
+	t.Helper()
+	assertStatus(t, w, status)
+	var resp handlers.ErrorResp
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body %s is not an ErrorResp: %v", w.Body, err)
+	}
+	if !strings.Contains(resp.Error, msg) {
+		t.Errorf("got error %q, want it to contain %q", resp.Error, msg)
+	}
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+}
+
+func TestCRUD(t *testing.T) {
+	srv := server(t, nil)
+
+	assertStatus(t, do(srv, "POST", "/authors", `{"name": "alice"}`), http.StatusCreated)
+	w := do(srv, "GET", "/authors/1", "")
+	assertStatus(t, w, http.StatusOK)
+	var author handlers.GetAuthorResp
+	decode(t, w, &author)
+	if author.Author.Name != "alice" {
+		t.Errorf("got %+v", author.Author)
+	}
+
+	w = do(srv, "POST", "/posts", `{"author_id": 1, "title": "hello", "content": "world"}`)
+	assertStatus(t, w, http.StatusCreated)
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("got ETag %s after add", etag)
+	}
+
+	w = do(srv, "PUT", "/posts/1", `{"author_id": 1, "title": "hi", "content": "world", "created_at": "2022-01-01T00:00:00Z"}`)
+	assertStatus(t, w, http.StatusOK)
+	w = do(srv, "PATCH", "/posts/1", `{"content": "there"}`)
+	assertStatus(t, w, http.StatusOK)
+	var post handlers.GetPostResp
+	decode(t, w, &post)
+	if post.Post.Title != "hi" || post.Post.Content != "there" || post.Post.Version != 3 {
+		t.Errorf("got %+v after update and patch", post.Post)
+	}
+
+	w = do(srv, "GET", "/authors/1/posts", "")
+	assertStatus(t, w, http.StatusOK)
+	var posts handlers.ListPostsResp
+	decode(t, w, &posts)
+	if len(posts.Posts) != 1 || posts.Posts[0].Id != 1 {
+		t.Errorf("got %+v", posts.Posts)
+	}
+
+	assertStatus(t, do(srv, "DELETE", "/posts/1", ""), http.StatusOK)
+	assertStatus(t, do(srv, "DELETE", "/authors/1", ""), http.StatusOK)
+	assertError(t, do(srv, "GET", "/authors/1", ""), http.StatusNotFound, "author 1 not found")
+}
+
+func TestNotFound(t *testing.T) {
+	srv := server(t, nil)
+
+	for _, req := range []struct{ method, target, body string }{
+		{"GET", "/authors/99", ""},
+		{"GET", "/authors/99/posts", ""},
+		{"PUT", "/authors/99", `{"name": "x"}`},
+		{"PATCH", "/authors/99", `{"name": "x"}`},
+		{"DELETE", "/authors/99", ""},
+		{"GET", "/posts/99", ""},
+		{"PUT", "/posts/99", `{"author_id": 1, "title": "t", "content": "c", "created_at": "2022-01-01T00:00:00Z"}`},
+		{"PATCH", "/posts/99", `{"title": "x"}`},
+		{"DELETE", "/posts/99", ""},
+	} {
+		t.Run(req.method+" "+req.target, func(t *testing.T) {
+			assertError(t, do(srv, req.method, req.target, req.body), http.StatusNotFound, "99 not found")
+		})
+	}
+}
+
+func TestMalformedId(t *testing.T) {
+	srv := server(t, nil)
+
+	for _, id := range []string{"abc", "-1", "1.5", "18446744073709551616"} {
+		for _, req := range []struct{ method, target, body string }{
+			{"GET", "/authors/" + id, ""},
+			{"GET", "/authors/" + id + "/posts", ""},
+			{"PUT", "/authors/" + id, `{"name": "x"}`},
+			{"PATCH", "/authors/" + id, `{"name": "x"}`},
+			{"DELETE", "/authors/" + id, ""},
+			{"GET", "/posts/" + id, ""},
+			{"PUT", "/posts/" + id, `{"author_id": 1, "title": "t", "content": "c", "created_at": "2022-01-01T00:00:00Z"}`},
+			{"PATCH", "/posts/" + id, `{"title": "x"}`},
+			{"DELETE", "/posts/" + id, ""},
+		} {
+			t.Run(req.method+" "+req.target, func(t *testing.T) {
+				assertError(t, do(srv, req.method, req.target, req.body), http.StatusBadRequest, "incorrect id: "+id)
+			})
+		}
+	}
+}
+
+// failingAuthors and failingPosts fail every Get and List with err.
+type failingAuthors struct {
+	storage.IAuthors
+	err error
+}
+
+func (a failingAuthors) Get(context.Context, uint64) (*entities.Author, error) {
+	return nil, a.err
+}
+
+func (a failingAuthors) List(context.Context, query.Options) ([]entities.Author, string, error) {
+	return nil, "", a.err
+}
+
+type failingPosts struct {
+	storage.IPosts
+	err error
+}
+
+func (p failingPosts) Get(context.Context, uint64) (*entities.Post, error) {
+	return nil, p.err
+}
+
+func (p failingPosts) List(context.Context, query.Options) ([]entities.Post, string, error) {
+	return nil, "", p.err
+}
+
+func TestStorageErrors(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		status int
+		msg    string
+	}{
+		{errs.New(errs.ErrNotFound, "gone"), http.StatusNotFound, "gone"},
+		{errs.New(errs.ErrConflict, "taken"), http.StatusConflict, "taken"},
+		{errs.New(errs.ErrPrecondition, "stale"), http.StatusPreconditionFailed, "stale"},
+		{errs.New(errs.ErrForeignKey, "dangling"), http.StatusUnprocessableEntity, "dangling"},
+		{errs.New(errs.ErrInvalid, "too long"), http.StatusUnprocessableEntity, "too long"},
+		{errs.Wrap(errs.ErrUnavailable, "try later", errors.New("dial tcp: refused")), http.StatusServiceUnavailable, "try later"},
+		{errs.New(errs.ErrForbidden, "not yours"), http.StatusForbidden, "not yours"},
+		// Unclassified errors don't leak the driver message.
+		{errors.New("pq: secret detail"), http.StatusInternalServerError, "internal error"},
+	} {
+		t.Run(c.err.Error(), func(t *testing.T) {
+			srv := server(t, &storage.Storage{
+				Authors: failingAuthors{err: c.err},
+				Posts:   failingPosts{err: c.err},
+			})
+			for _, target := range []string{"/authors", "/authors/1", "/posts", "/posts/1"} {
+				w := do(srv, "GET", target, "")
+				assertError(t, w, c.status, c.msg)
+				if strings.Contains(w.Body.String(), "dial tcp") || strings.Contains(w.Body.String(), "secret") {
+					t.Errorf("%s: driver message leaked: %s", target, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestStorageErrorsFromMemory(t *testing.T) {
+	srv := server(t, nil)
+	assertStatus(t, do(srv, "POST", "/authors", `{"name": "alice"}`), http.StatusCreated)
+
+	w := do(srv, "POST", "/posts", `{"author_id": 42, "title": "t", "content": "c"}`)
+	assertError(t, w, http.StatusUnprocessableEntity, "posts_author_id_fk")
+
+	assertStatus(t, do(srv, "POST", "/posts", `{"author_id": 1, "title": "t", "content": "c"}`), http.StatusCreated)
+	w = do(srv, "DELETE", "/authors/1", "")
+	assertError(t, w, http.StatusUnprocessableEntity, "still referenced")
+
+	w = do(srv, "PUT", "/authors/1", `{"name": "bob"}`, "If-Match", `"7"`)
+	assertStatus(t, w, http.StatusPreconditionFailed)
+}
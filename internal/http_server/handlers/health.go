@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"crud/internal/storage"
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the dependency checks of a /readyz request.
+const readyTimeout = 2 * time.Second
+
+// Drain makes /readyz fail from now on, so that load balancers stop sending
+// requests before the server shuts down.
+func (h *Handler) Drain() {
+	h.draining.Store(true)
+}
+
+// Healthz tells whether the process is alive. It does not look at the
+// database: restarting the process would not fix it.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	writeHealth(w, map[string]storage.Check{"process": {Ok: true}})
+}
+
+// Readyz tells whether the service can take requests: the database answers,
+// the schema is up to date and no shutdown is in progress. The body only
+// names the checks, what failed and why is logged.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := h.stor.Checks(ctx)
+
+	shutdown := storage.Check{Ok: true}
+	if h.draining.Load() {
+		shutdown = storage.Check{Error: "shutting down"}
+	}
+	checks["shutdown"] = shutdown
+
+	if !writeHealth(w, checks) {
+		h.lgr.Warn().Interface("checks", checks).Msg("not ready")
+	}
+}
+
+// writeHealth answers 503 if a check failed and tells whether all are ok.
+func writeHealth(w http.ResponseWriter, checks map[string]storage.Check) bool {
+	ok := true
+	resp := HealthResp{Status: "ok", Checks: make(map[string]string, len(checks))}
+	for name, check := range checks {
+		resp.Checks[name] = "ok"
+		if !check.Ok {
+			resp.Checks[name] = "failed"
+			ok = false
+		}
+	}
+
+	if !ok {
+		resp.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	b, _ := json.Marshal(resp)
+	fmt.Fprint(w, string(b))
+
+	return ok
+}
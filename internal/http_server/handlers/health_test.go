@@ -0,0 +1,38 @@
+package handlers_test
+
+import (
+	"crud/internal/config"
+	"crud/internal/http_server"
+	"crud/internal/http_server/handlers"
+	"crud/internal/storage"
+	"crud/pkg/metrics"
+	"crud/pkg/tracing"
+	"github.com/rs/zerolog"
+	"net/http"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	cfg := config.Default()
+	cfg.Database.Name = "memory"
+	snapshot := config.NewSnapshot(cfg)
+	reg := metrics.NewRegistry()
+	tracer := tracing.NewTracer("crud", nil, 1, nil)
+	stor := storage.NewStorage(snapshot, zerolog.Nop(), reg, tracer)
+	handler := handlers.NewHandler(snapshot, zerolog.Nop(), stor, reg, tracer, nil)
+	srv := http_server.NewRouter(handler)
+
+	w := do(srv, "GET", "/readyz", "")
+	assertStatus(t, w, http.StatusOK)
+	if got := w.Body.String(); got != `{"status":"ok","checks":{"database":"ok","shutdown":"ok"}}` {
+		t.Errorf("got %s", got)
+	}
+
+	// Only the check names and statuses are told, not why they failed.
+	handler.Drain()
+	w = do(srv, "GET", "/readyz", "")
+	assertStatus(t, w, http.StatusServiceUnavailable)
+	if got := w.Body.String(); got != `{"status":"unavailable","checks":{"database":"ok","shutdown":"failed"}}` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"crud/pkg/metrics"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	rejected *metrics.CounterVec
+}
+
+func newHTTPMetrics(reg *metrics.Registry) httpMetrics {
+	return httpMetrics{
+		requests: reg.Counter("http_requests_total",
+			"HTTP requests by route, method and status.", "route", "method", "status"),
+		duration: reg.Histogram("http_request_duration_seconds",
+			"Duration of HTTP requests.", nil, "route", "method"),
+		rejected: reg.Counter("http_requests_rejected_total",
+			"API requests turned away by rate limits or the in-flight cap.", "route", "method", "reason"),
+	}
+}
+
+// Metrics serves every metric in the Prometheus text format.
+func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	h.registry.ServeHTTP(w, r)
+}
@@ -3,21 +3,90 @@ package handlers
 import (
 	"context"
 	"crud/internal/constants"
+	"crud/internal/requestid"
+	"crud/pkg/tracing"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func (h *Handler) Middlware(handle httprouter.Handle) httprouter.Handle {
+// Middlware wraps the handle of route, the path template it is registered
+// under, which labels its metrics and names its span.
+func (h *Handler) Middlware(route string, handle httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		ctx := r.Context()
-		requestId := uuid.New().String()
-		ctx = context.WithValue(ctx, constants.RequestIdKey, requestId)
+		start := time.Now()
+
+		if record, ok := r.Context().Value(accessKey{}).(*accessRecord); ok {
+			record.route = route
+		}
+
+		ctx := tracing.WithRemoteParent(r.Context(), tracing.Extract(r.Header))
+		ctx, span := h.tracer.Start(ctx, r.Method+" "+route, tracing.KindServer)
+		defer span.End()
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.route", route)
+
+		requestId := r.Header.Get(constants.RequestIdKey)
+		if h.requestIdPattern == nil || !h.requestIdPattern.MatchString(requestId) {
+			requestId = uuid.New().String()
+		}
+		ctx = requestid.NewContext(ctx, requestId)
+		if timeout := h.cfg.Load().HttpServer.RequestTimeout; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout))
+			defer cancel()
+		}
 		r = r.WithContext(ctx)
 
 		w.Header().Add(constants.RequestIdKey, requestId)
 		w.Header().Add("Content-Type", "application/json")
+		tracing.Inject(ctx, w.Header())
+		span.SetAttr(constants.RequestIdKey, requestId)
+
+		rec := &responseRecorder{ResponseWriter: w}
+		handle(rec, r, ps)
+
+		status := rec.Status()
+		span.SetAttr("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
+
+		h.metrics.requests.Inc(route, r.Method, strconv.Itoa(status))
+		h.metrics.duration.Observe(time.Since(start).Seconds(), route, r.Method)
+	}
+}
+
+// responseRecorder keeps the status and the size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+	return n, err
+}
 
-		handle(w, r, ps)
+// Status is the status sent, 200 if the handler wrote nothing.
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
 	}
+	return rec.status
 }
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"crud/pkg/validate"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// patchError is a PATCH document that is well-formed but can't be applied.
+type patchError struct {
+	status int
+	msg    string
+}
+
+func (e *patchError) Error() string {
+	return e.msg
+}
+
+// readPatch returns the top-level members a PATCH request changes, with their
+// new values. Merge patches (RFC 7396) are the default; JSON Patch (RFC 6902)
+// operations are applied to the document returned by current, which is only
+// called for them.
+func readPatch(r *http.Request, current func() (interface{}, error)) (map[string]json.RawMessage, error) {
+	mediaType := mergePatchType
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, &patchError{http.StatusUnsupportedMediaType, fmt.Sprintf("incorrect content type: %s", ct)}
+		}
+	}
+
+	switch mediaType {
+	case mergePatchType, "application/json":
+		members := make(map[string]json.RawMessage)
+		if err := decodeJSON(r.Body, &members); err != nil {
+			return nil, err
+		}
+		return members, nil
+
+	case jsonPatchType:
+		var ops []patchOp
+		if err := decodeJSON(r.Body, &ops); err != nil {
+			return nil, err
+		}
+
+		doc, err := current()
+		if err != nil {
+			return nil, err
+		}
+		return applyJSONPatch(doc, ops)
+	}
+
+	return nil, &patchError{http.StatusUnsupportedMediaType,
+		fmt.Sprintf("unsupported content type %s, expected %s or %s", mediaType, mergePatchType, jsonPatchType)}
+}
+
+// decodePatch checks the changed members and decodes them into v, a request
+// whose fields are pointers so that absent members stay nil. Members can't be
+// removed, and neither id nor version can be changed.
+func decodePatch(members map[string]json.RawMessage, v interface{}) error {
+	var fieldErrs validate.Errors
+	for name, value := range members {
+		switch {
+		case name == "id", name == "version":
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: name, Rule: "readonly", Message: "can't be changed"})
+		case value == nil || string(value) == "null":
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: name, Rule: "required", Message: "can't be removed"})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		return fieldErrs
+	}
+
+	b, _ := json.Marshal(members)
+	return decodeRequest(bytes.NewReader(b), v)
+}
+
+// decodeJSON reads exactly one JSON value into v.
+func decodeJSON(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch runs the operations against the JSON form of doc and returns
+// the members whose value differs afterwards. Removed members are returned
+// with a nil value, added ones are left for decodePatch to reject. Our
+// documents are flat, so only paths to top-level members are supported.
+func applyJSONPatch(doc interface{}, ops []patchOp) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	original := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(b, &original); err != nil {
+		return nil, err
+	}
+
+	patched := make(map[string]json.RawMessage, len(original))
+	for name, value := range original {
+		patched[name] = value
+	}
+
+	for i, op := range ops {
+		if err = applyOp(patched, op); err != nil {
+			if pe, ok := err.(*patchError); ok {
+				pe.msg = fmt.Sprintf("operation %d (%s %s): %s", i, op.Op, op.Path, pe.msg)
+			}
+			return nil, err
+		}
+	}
+
+	changed := make(map[string]json.RawMessage)
+	for name, value := range original {
+		newValue, ok := patched[name]
+		if !ok {
+			changed[name] = nil
+			continue
+		}
+		if !jsonEqual(value, newValue) {
+			changed[name] = newValue
+		}
+	}
+	for name, value := range patched {
+		if _, ok := original[name]; !ok {
+			changed[name] = value
+		}
+	}
+
+	return changed, nil
+}
+
+func applyOp(doc map[string]json.RawMessage, op patchOp) error {
+	name, err := member(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace":
+		if op.Value == nil {
+			return &patchError{http.StatusBadRequest, "value is missing"}
+		}
+		if _, ok := doc[name]; !ok && op.Op == "replace" {
+			return &patchError{http.StatusUnprocessableEntity, "path not found"}
+		}
+		doc[name] = op.Value
+
+	case "remove":
+		if _, ok := doc[name]; !ok {
+			return &patchError{http.StatusUnprocessableEntity, "path not found"}
+		}
+		delete(doc, name)
+
+	case "move", "copy":
+		from, err := member(op.From)
+		if err != nil {
+			return err
+		}
+		value, ok := doc[from]
+		if !ok {
+			return &patchError{http.StatusUnprocessableEntity, "from path not found"}
+		}
+		if op.Op == "move" {
+			delete(doc, from)
+		}
+		doc[name] = value
+
+	case "test":
+		if op.Value == nil {
+			return &patchError{http.StatusBadRequest, "value is missing"}
+		}
+		value, ok := doc[name]
+		if !ok || !jsonEqual(value, op.Value) {
+			return &patchError{http.StatusConflict, "test failed"}
+		}
+
+	default:
+		return &patchError{http.StatusBadRequest, fmt.Sprintf("unknown operation %q", op.Op)}
+	}
+
+	return nil
+}
+
+// member resolves a JSON Pointer (RFC 6901) to a top-level member name.
+func member(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return "", &patchError{http.StatusBadRequest, fmt.Sprintf("incorrect path %q", pointer)}
+	}
+	name := pointer[1:]
+	if strings.Contains(name, "/") {
+		return "", &patchError{http.StatusUnprocessableEntity, fmt.Sprintf("path %q is not a top-level member", pointer)}
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(name), nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+
+	da := json.NewDecoder(bytes.NewReader(a))
+	da.UseNumber()
+	db := json.NewDecoder(bytes.NewReader(b))
+	db.UseNumber()
+	if da.Decode(&va) != nil || db.Decode(&vb) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(va, vb)
+}
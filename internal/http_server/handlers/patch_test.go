@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"crud/internal/http_server/handlers"
+	"net/http"
+	"testing"
+)
+
+// patched returns a server with author 1 and post 1 by that author.
+func patched(t *testing.T) http.Handler {
+	t.Helper()
+	srv := server(t, nil)
+	assertStatus(t, do(srv, "POST", "/authors", `{"name": "alice"}`), http.StatusCreated)
+	assertStatus(t, do(srv, "POST", "/posts", `{"author_id": 1, "title": "t", "content": "c"}`), http.StatusCreated)
+	return srv
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, c := range []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		status      int
+		msg         string
+	}{
+		{"default type", "/posts/1", "", `{"title": "u"}`, http.StatusOK, ""},
+		{"merge patch type", "/posts/1", "application/merge-patch+json", `{"title": "u"}`, http.StatusOK, ""},
+		{"json type", "/authors/1", "application/json; charset=utf-8", `{"name": "bob"}`, http.StatusOK, ""},
+		{"null removes", "/posts/1", "", `{"title": null}`, http.StatusUnprocessableEntity, "validation failed"},
+		{"id is readonly", "/posts/1", "", `{"id": 2}`, http.StatusUnprocessableEntity, "validation failed"},
+		{"version is readonly", "/authors/1", "", `{"version": 5}`, http.StatusUnprocessableEntity, "validation failed"},
+		{"blank", "/authors/1", "", `{"name": ""}`, http.StatusUnprocessableEntity, "validation failed"},
+		{"unknown member", "/authors/1", "", `{"age": 3}`, http.StatusBadRequest, `unknown field "age"`},
+		{"not an object", "/authors/1", "", `["name"]`, http.StatusBadRequest, "incorrect request"},
+		{"trailing data", "/authors/1", "", `{"name": "bob"} {}`, http.StatusBadRequest, "unexpected data after the JSON object"},
+		{"unsupported type", "/authors/1", "text/plain", `{"name": "bob"}`, http.StatusUnsupportedMediaType, "unsupported content type text/plain"},
+		{"malformed type", "/authors/1", "application/", `{"name": "bob"}`, http.StatusUnsupportedMediaType, "incorrect content type"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv := patched(t)
+			w := do(srv, "PATCH", c.target, c.body, "Content-Type", c.contentType)
+			if c.status == http.StatusOK {
+				assertStatus(t, w, c.status)
+				return
+			}
+			assertError(t, w, c.status, c.msg)
+		})
+	}
+}
+
+func TestMergePatchFields(t *testing.T) {
+	srv := patched(t)
+	w := do(srv, "PATCH", "/posts/1", `{"id": 2, "title": null, "content": "d"}`)
+	assertStatus(t, w, http.StatusUnprocessableEntity)
+	var resp handlers.ValidationErrorResp
+	decode(t, w, &resp)
+	fields := make(map[string]string)
+	for _, fe := range resp.Fields {
+		fields[fe.Field] = fe.Rule + ": " + fe.Message
+	}
+	if len(fields) != 2 || fields["id"] != "readonly: can't be changed" ||
+		fields["title"] != "required: can't be removed" {
+		t.Errorf("got %+v", resp.Fields)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		body   string
+		status int
+		msg    string
+		title  string
+	}{
+		{"replace", `[{"op": "replace", "path": "/title", "value": "u"}]`, http.StatusOK, "", "u"},
+		{"test then replace", `[{"op": "test", "path": "/title", "value": "t"}, {"op": "replace", "path": "/title", "value": "u"}]`,
+			http.StatusOK, "", "u"},
+		{"copy", `[{"op": "copy", "from": "/content", "path": "/title"}]`, http.StatusOK, "", "c"},
+		{"escaped path", `[{"op": "test", "path": "/ti~1tle", "value": "t"}]`, http.StatusConflict, "test failed", "t"},
+		{"failed test", `[{"op": "test", "path": "/title", "value": "x"}, {"op": "replace", "path": "/title", "value": "u"}]`,
+			http.StatusConflict, "operation 0 (test /title): test failed", "t"},
+		{"test of a missing member", `[{"op": "test", "path": "/subtitle", "value": "x"}]`, http.StatusConflict, "test failed", "t"},
+		{"nested path", `[{"op": "replace", "path": "/title/0", "value": "u"}]`,
+			http.StatusUnprocessableEntity, `path "/title/0" is not a top-level member`, "t"},
+		{"nested from", `[{"op": "move", "from": "/a/b", "path": "/title"}]`,
+			http.StatusUnprocessableEntity, `path "/a/b" is not a top-level member`, "t"},
+		{"replace a missing member", `[{"op": "replace", "path": "/subtitle", "value": "u"}]`,
+			http.StatusUnprocessableEntity, "path not found", "t"},
+		{"remove", `[{"op": "remove", "path": "/title"}]`, http.StatusUnprocessableEntity, "validation failed", "t"},
+		{"add a member", `[{"op": "add", "path": "/subtitle", "value": "u"}]`, http.StatusBadRequest, `unknown field "subtitle"`, "t"},
+		{"replace the version", `[{"op": "replace", "path": "/version", "value": 9}]`, http.StatusUnprocessableEntity, "validation failed", "t"},
+		{"unknown op", `[{"op": "append", "path": "/title", "value": "u"}]`, http.StatusBadRequest, `unknown operation "append"`, "t"},
+		{"missing value", `[{"op": "replace", "path": "/title"}]`, http.StatusBadRequest, "value is missing", "t"},
+		{"relative path", `[{"op": "replace", "path": "title", "value": "u"}]`, http.StatusBadRequest, `incorrect path "title"`, "t"},
+		{"not a list", `{"op": "replace", "path": "/title", "value": "u"}`, http.StatusBadRequest, "incorrect request", "t"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			srv := patched(t)
+			w := do(srv, "PATCH", "/posts/1", c.body, "Content-Type", "application/json-patch+json")
+			if c.status == http.StatusOK {
+				assertStatus(t, w, c.status)
+			} else {
+				assertError(t, w, c.status, c.msg)
+			}
+
+			var post handlers.GetPostResp
+			decode(t, do(srv, "GET", "/posts/1", ""), &post)
+			if post.Post.Title != c.title {
+				t.Errorf("got title %q, want %q", post.Post.Title, c.title)
+			}
+		})
+	}
+}
+
+func TestJSONPatchMissingResource(t *testing.T) {
+	srv := patched(t)
+	w := do(srv, "PATCH", "/posts/9", `[{"op": "replace", "path": "/title", "value": "u"}]`,
+		"Content-Type", "application/json-patch+json")
+	assertError(t, w, http.StatusNotFound, "9 not found")
+}
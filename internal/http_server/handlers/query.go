@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// parseListOptions reads limit, sort, order and cursor from the query string.
+// Filters are only parsed for posts.
+func parseListOptions(values url.Values, sortFields []string, withFilter bool) (opts query.Options, err error) {
+	if s := values.Get("limit"); s != "" {
+		opts.Limit, err = strconv.Atoi(s)
+		if err != nil || opts.Limit < 1 || opts.Limit > query.MaxLimit {
+			return opts, fmt.Errorf("incorrect limit: %s, expected 1..%d", s, query.MaxLimit)
+		}
+	}
+
+	if s := values.Get("sort"); s != "" {
+		if !contains(sortFields, s) {
+			return opts, fmt.Errorf("incorrect sort: %s, expected one of %v", s, sortFields)
+		}
+		opts.Sort = s
+	}
+
+	if s := values.Get("order"); s != "" {
+		if s != string(query.Asc) && s != string(query.Desc) {
+			return opts, fmt.Errorf("incorrect order: %s, expected %s or %s", s, query.Asc, query.Desc)
+		}
+		opts.Order = query.Order(s)
+	}
+
+	if s := values.Get("cursor"); s != "" {
+		n := opts.Normalize()
+		opts.After, err = query.DecodeCursor(s, n.Sort, n.Order)
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	if !withFilter {
+		return opts, nil
+	}
+
+	if s := values.Get("author_id"); s != "" {
+		opts.Filter.AuthorId, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("incorrect author_id: %s", s)
+		}
+	}
+
+	if s := values.Get("created_from"); s != "" {
+		opts.Filter.CreatedFrom, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return opts, fmt.Errorf("incorrect created_from: %s", s)
+		}
+	}
+
+	if s := values.Get("created_to"); s != "" {
+		opts.Filter.CreatedTo, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return opts, fmt.Errorf("incorrect created_to: %s", s)
+		}
+	}
+
+	opts.Filter.TitlePrefix = values.Get("title_prefix")
+
+	return opts, nil
+}
+
+// listFields logs the options a client sent as user data. The title prefix
+// is logged as "title", so that it is redacted like titles are.
+func listFields(opts query.Options) *logger.Fields {
+	fields := logger.Dict()
+	if opts.Limit > 0 {
+		fields.Int("limit", opts.Limit)
+	}
+	if opts.Sort != "" {
+		fields.Str("sort", opts.Sort)
+	}
+	if opts.Order != "" {
+		fields.Str("order", string(opts.Order))
+	}
+	f := opts.Filter
+	if f.AuthorId != 0 {
+		fields.Uint64("author_id", f.AuthorId)
+	}
+	if !f.CreatedFrom.IsZero() {
+		fields.Time("created_from", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		fields.Time("created_to", f.CreatedTo)
+	}
+	if f.TitlePrefix != "" {
+		fields.Str("title", f.TitlePrefix)
+	}
+	return fields
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
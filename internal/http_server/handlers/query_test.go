@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crud/internal/config"
+	"crud/internal/http_server"
+	"crud/internal/http_server/handlers"
+	"crud/internal/storage"
+	"crud/pkg/logger"
+	"crud/pkg/metrics"
+	"crud/pkg/tracing"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestListOptionsInvalid(t *testing.T) {
+	srv := server(t, nil)
+
+	for _, c := range []struct {
+		target, msg string
+	}{
+		{"/authors?limit=0", "incorrect limit: 0"},
+		{"/authors?limit=501", "incorrect limit: 501"},
+		{"/authors?limit=x", "incorrect limit: x"},
+		{"/authors?sort=title", "incorrect sort: title"},
+		{"/authors?order=up", "incorrect order: up"},
+		{"/authors?cursor=!!!", "invalid cursor"},
+		{"/posts?limit=-1", "incorrect limit: -1"},
+		{"/posts?sort=name", "incorrect sort: name"},
+		{"/posts?order=ASC", "incorrect order: ASC"},
+		{"/posts?author_id=x", "incorrect author_id: x"},
+		{"/posts?created_from=yesterday", "incorrect created_from: yesterday"},
+		{"/posts?created_to=2022-01-01", "incorrect created_to: 2022-01-01"},
+		{"/authors/1/posts?sort=id&order=sideways", "incorrect order: sideways"},
+	} {
+		t.Run(c.target, func(t *testing.T) {
+			assertError(t, do(srv, "GET", c.target, ""), http.StatusBadRequest, c.msg)
+		})
+	}
+}
+
+// TestCursorReuse checks that a cursor is refused with another sort or order
+// than the one it was issued for.
+func TestCursorReuse(t *testing.T) {
+	srv := server(t, nil)
+	for _, name := range []string{"alice", "bob"} {
+		assertStatus(t, do(srv, "POST", "/authors", `{"name": "`+name+`"}`), http.StatusCreated)
+	}
+	for _, title := range []string{"first", "second"} {
+		assertStatus(t, do(srv, "POST", "/posts", `{"author_id": 1, "title": "`+title+`", "content": "c"}`), http.StatusCreated)
+	}
+
+	for _, c := range []struct {
+		path, sort, order string
+		reused            string
+	}{
+		{"/authors", "name", "asc", "sort=id&order=asc"},
+		{"/authors", "name", "asc", "sort=name&order=desc"},
+		{"/authors", "id", "asc", "order=desc"},
+		{"/posts", "title", "desc", "sort=created_at&order=desc"},
+		{"/posts", "created_at", "asc", "sort=created_at&order=desc"},
+		{"/authors/1/posts", "id", "asc", "sort=title"},
+	} {
+		t.Run(c.path+" "+c.sort+" "+c.order+" "+c.reused, func(t *testing.T) {
+			w := do(srv, "GET", c.path+"?limit=1&sort="+c.sort+"&order="+c.order, "")
+			assertStatus(t, w, http.StatusOK)
+			var page struct {
+				NextCursor string `json:"next_cursor"`
+			}
+			decode(t, w, &page)
+			if page.NextCursor == "" {
+				t.Fatalf("no next cursor in %s", w.Body)
+			}
+			cursor := url.QueryEscape(page.NextCursor)
+
+			w = do(srv, "GET", c.path+"?limit=1&sort="+c.sort+"&order="+c.order+"&cursor="+cursor, "")
+			assertStatus(t, w, http.StatusOK)
+			w = do(srv, "GET", c.path+"?limit=1&"+c.reused+"&cursor="+cursor, "")
+			assertError(t, w, http.StatusBadRequest, "it was issued for sort="+c.sort+"&order="+c.order)
+		})
+	}
+}
+
+func TestListQueryRedacted(t *testing.T) {
+	previous := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	t.Cleanup(func() { zerolog.SetGlobalLevel(previous) })
+	if err := logger.SetRedaction(logger.Redaction{Deny: []string{"title"}, Mode: logger.RedactMask}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.SetRedaction(logger.Redaction{}) })
+
+	var logs bytes.Buffer
+	cfg := config.Default()
+	cfg.Database.Name = "memory"
+	snapshot := config.NewSnapshot(cfg)
+	reg := metrics.NewRegistry()
+	tracer := tracing.NewTracer("crud", nil, 1, nil)
+	stor := storage.NewStorage(snapshot, zerolog.Nop(), reg, tracer)
+	srv := http_server.NewRouter(handlers.NewHandler(snapshot, zerolog.New(&logs), stor, reg, tracer, nil))
+
+	for _, target := range []string{"/posts?title_prefix=secret&limit=5", "/authors/1/posts?title_prefix=secret"} {
+		logs.Reset()
+		do(srv, "GET", target, "")
+		if line := logs.String(); strings.Contains(line, "secret") || !strings.Contains(line, `"title":"[redacted]"`) {
+			t.Errorf("%s logged %s", target, line)
+		}
+	}
+	if line := logs.String(); strings.Contains(line, "title_prefix") {
+		t.Errorf("logged the raw query: %s", line)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"crud/internal/auth"
+	"crud/internal/config"
+	"crud/internal/constants"
+	"crud/internal/requestid"
+	"crud/pkg/ratelimit"
+	"crud/pkg/tracing"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// limits is the rate_limit config parsed, for the config it came from.
+type limits struct {
+	cfg      *config.Config
+	perIP    ratelimit.Limit
+	fallback ratelimit.Limit
+	// routes is keyed by "METHOD /route".
+	routes  map[string]ratelimit.Limit
+	proxies []*net.IPNet
+}
+
+// RouteLimit is an entry of rate_limit.routes.
+type RouteLimit struct {
+	Method string
+	Route  string
+	Limit  ratelimit.Limit
+}
+
+// ParseRouteLimit reads "METHOD /route=limit".
+func ParseRouteLimit(entry string) (RouteLimit, error) {
+	rule, limit, ok := strings.Cut(entry, "=")
+	method, route, _ := strings.Cut(strings.TrimSpace(rule), " ")
+	route = strings.TrimSpace(route)
+	if !ok || method == "" || !strings.HasPrefix(route, "/") {
+		return RouteLimit{}, fmt.Errorf("%q is not METHOD /route=limit", entry)
+	}
+	l, err := ratelimit.ParseLimit(limit)
+	if err != nil {
+		return RouteLimit{}, err
+	}
+	return RouteLimit{Method: strings.ToUpper(method), Route: route, Limit: l}, nil
+}
+
+// loadLimits parses the rate_limit config again only after a reload. The
+// config was checked by cmd, parse errors can't happen.
+func (h *Handler) loadLimits() *limits {
+	cfg := h.cfg.Load()
+	if l := h.limits.Load(); l != nil && l.cfg == cfg {
+		return l
+	}
+
+	l := &limits{cfg: cfg, routes: make(map[string]ratelimit.Limit)}
+	l.perIP, _ = ratelimit.ParseLimit(cfg.RateLimit.PerIP)
+	l.fallback, _ = ratelimit.ParseLimit(cfg.RateLimit.Default)
+	for _, entry := range cfg.RateLimit.Routes {
+		if rule, err := ParseRouteLimit(entry); err == nil {
+			l.routes[rule.Method+" "+rule.Route] = rule.Limit
+		}
+	}
+	for _, cidr := range cfg.RateLimit.TrustedProxies {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			l.proxies = append(l.proxies, network)
+		}
+	}
+	h.limits.Store(l)
+	return l
+}
+
+// bucket returns the name of the limit of a request and the limit. Routes
+// without one of their own share the default.
+func (l *limits) bucket(method, route string) (string, ratelimit.Limit) {
+	for _, name := range []string{method + " " + route, "* " + route} {
+		if limit, ok := l.routes[name]; ok {
+			return name, limit
+		}
+	}
+	return "default", l.fallback
+}
+
+// client tells apart the senders of requests, by principal if there is one.
+func (l *limits) client(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.Method + ":" + p.Subject
+	}
+	return "ip:" + clientIP(r, l.proxies)
+}
+
+// clientIP is the address r comes from. When it comes from a trusted proxy,
+// X-Forwarded-For is read from the end, and the first address not of a
+// trusted proxy is the client.
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trusted(ip, proxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		host = hop.String()
+		if !trusted(hop, proxies) {
+			break
+		}
+	}
+	return host
+}
+
+func trusted(ip net.IP, proxies []*net.IPNet) bool {
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Throttle goes before Authenticate. It answers 503 to requests beyond
+// max_in_flight, and then limits every client IP address to per_ip, so that
+// floods of requests failing authentication are limited too. Shed requests
+// don't use up the rate limits of their client.
+func (h *Handler) Throttle(route string, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		n := h.inFlight.Add(1)
+		defer h.inFlight.Add(-1)
+
+		cfg := h.cfg.Load().RateLimit
+		if !cfg.Enabled {
+			handle(w, r, ps)
+			return
+		}
+
+		l := h.loadLimits()
+		client := "ip:" + clientIP(r, l.proxies)
+		if cfg.MaxInFlight > 0 && n > int64(cfg.MaxInFlight) {
+			w.Header().Set("Retry-After", "1")
+			h.reject(w, r, route, client, "", "in_flight", http.StatusServiceUnavailable, "server busy")
+			return
+		}
+
+		if !h.allow(w, "per_ip", client, l.perIP) {
+			h.reject(w, r, route, client, "per_ip", "ip_rate_limit", http.StatusTooManyRequests, "too many requests")
+			return
+		}
+		handle(w, r, ps)
+	}
+}
+
+// RateLimit lets handle through the requests within the rate limits of the
+// client. It goes after Authenticate, for clients to be told apart by
+// principal.
+func (h *Handler) RateLimit(route string, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if !h.cfg.Load().RateLimit.Enabled {
+			handle(w, r, ps)
+			return
+		}
+
+		l := h.loadLimits()
+		name, limit := l.bucket(r.Method, route)
+		client := l.client(r)
+		if !h.allow(w, name, client, limit) {
+			h.reject(w, r, route, client, name, "rate_limit", http.StatusTooManyRequests, "too many requests")
+			return
+		}
+		handle(w, r, ps)
+	}
+}
+
+// allow takes a token from the bucket of client under the limit called name.
+// Limited responses carry the RateLimit-Limit, -Remaining and -Reset
+// headers, and Retry-After when the bucket is empty.
+func (h *Handler) allow(w http.ResponseWriter, name, client string, limit ratelimit.Limit) bool {
+	res := h.limiter.Allow(name+"|"+client, limit)
+	if !limit.Unlimited() {
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+	}
+	if !res.Allowed {
+		w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+	}
+	return res.Allowed
+}
+
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, route, client, limit, reason string,
+	status int, msg string) {
+	ctx := r.Context()
+	h.lgr.Debug().
+		Str("handler", "RateLimit").
+		Str(constants.RequestIdKey, requestid.FromContext(ctx)).
+		EmbedObject(tracing.FromContext(ctx)).
+		Str("client", client).
+		Str("limit", limit).
+		Str("reason", reason).
+		Msg("request rejected")
+	h.metrics.rejected.Inc(route, r.Method, reason)
+	writeError(w, status, msg)
+}
+
+// ceilSeconds writes d in whole seconds, rounded up, as headers want them.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,134 @@
+package handlers_test
+
+import (
+	"context"
+	"crud/internal/auth"
+	"crud/internal/config"
+	"crud/internal/entities"
+	"crud/internal/http_server/handlers"
+	"crud/internal/storage"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// token accepts "Bearer good" and refuses any other Authorization.
+type token struct{}
+
+func (token) Verify(r *http.Request) (*auth.Principal, error) {
+	switch r.Header.Get("Authorization") {
+	case "":
+		return nil, auth.ErrNoCredentials
+	case "Bearer good":
+		return &auth.Principal{Method: "token", Subject: "good", Role: auth.RoleAdmin}, nil
+	}
+	return nil, fmt.Errorf("%w: bad token", auth.ErrInvalid)
+}
+
+func from(srv http.Handler, addr, target, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	r.RemoteAddr = addr
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimitBeforeAuthentication(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.PerIP = "1/h:3"
+	srv := serverWith(t, cfg, nil, auth.Authenticator{token{}})
+
+	for i := 0; i < 3; i++ {
+		assertError(t, from(srv, "192.0.2.1:1000", "/authors", "Bearer bad"), http.StatusUnauthorized, "invalid credentials")
+	}
+	w := from(srv, "192.0.2.1:1001", "/authors", "Bearer bad")
+	assertError(t, w, http.StatusTooManyRequests, "too many requests")
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("got headers %v", w.Header())
+	}
+	// Valid credentials from the same address are limited as well.
+	assertStatus(t, from(srv, "192.0.2.1:1002", "/authors", "Bearer good"), http.StatusTooManyRequests)
+
+	// Other addresses have buckets of their own.
+	assertStatus(t, from(srv, "192.0.2.2:1000", "/authors", "Bearer good"), http.StatusOK)
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Default = "1/h:2"
+	srv := serverWith(t, cfg, nil, auth.Authenticator{token{}})
+
+	for i := 0; i < 2; i++ {
+		w := from(srv, fmt.Sprintf("192.0.2.%d:1000", i+1), "/authors", "Bearer good")
+		assertStatus(t, w, http.StatusOK)
+		if got := w.Header().Get("RateLimit-Remaining"); got != fmt.Sprint(1-i) {
+			t.Errorf("got RateLimit-Remaining %s after %d requests", got, i+1)
+		}
+	}
+	// The principal is limited whatever its address.
+	assertStatus(t, from(srv, "192.0.2.3:1000", "/authors", "Bearer good"), http.StatusTooManyRequests)
+}
+
+// blockingAuthors holds every Get until release is closed.
+type blockingAuthors struct {
+	storage.IAuthors
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (a blockingAuthors) Get(_ context.Context, id uint64) (*entities.Author, error) {
+	a.entered <- struct{}{}
+	<-a.release
+	return &entities.Author{Id: id, Name: "alice", Version: 1}, nil
+}
+
+func TestInFlightDoesNotTakeTokens(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.MaxInFlight = 1
+	cfg.RateLimit.PerIP = "1/h:2"
+	cfg.RateLimit.Default = "0"
+	authors := blockingAuthors{entered: make(chan struct{}), release: make(chan struct{})}
+	srv := serverWith(t, cfg, &storage.Storage{Authors: authors}, nil)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- from(srv, "192.0.2.1:1000", "/authors/1", "") }()
+	<-authors.entered
+
+	for i := 0; i < 3; i++ {
+		w := from(srv, "192.0.2.1:1001", "/authors/1", "")
+		assertError(t, w, http.StatusServiceUnavailable, "server busy")
+		if w.Header().Get("Retry-After") != "1" {
+			t.Errorf("got Retry-After %q", w.Header().Get("Retry-After"))
+		}
+	}
+
+	close(authors.release)
+	assertStatus(t, <-done, http.StatusOK)
+	go func() { <-authors.entered }()
+	// The shed requests left the second token of the address.
+	w := from(srv, "192.0.2.1:1002", "/authors/1", "")
+	assertStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("got RateLimit-Remaining %s, want 0", got)
+	}
+}
+
+func TestParseRouteLimit(t *testing.T) {
+	rule, err := handlers.ParseRouteLimit("get /posts/:id=5/s:10")
+	if err != nil || rule.Method != "GET" || rule.Route != "/posts/:id" || rule.Limit.Burst != 10 {
+		t.Errorf("got %+v, %v", rule, err)
+	}
+
+	for _, entry := range []string{"/posts=5", "GET posts=5", "GET /posts", "GET /posts=fast"} {
+		if _, err := handlers.ParseRouteLimit(entry); err == nil {
+			t.Errorf("%q was accepted", entry)
+		}
+	}
+}
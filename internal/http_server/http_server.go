@@ -12,52 +12,98 @@ import (
 )
 
 type Server struct {
-	cfg        *config.Config
+	cfg        *config.Snapshot
 	lgr        zerolog.Logger
 	httpServer *http.Server
 }
 
-func NewServer(cfg *config.Config, lgr zerolog.Logger, handler *handlers.Handler,
+// NewServer starts serving. The listen address, the connection timeouts and
+// the TLS settings are read once, a config reload does not change them. The
+// TLS certificate is reloaded when its files change.
+func NewServer(cfg *config.Snapshot, lgr zerolog.Logger, handler *handlers.Handler,
 ) (*Server, chan error) {
-	netListener, err := net.Listen("tcp", cfg.HttpServer.ListenAddress)
+	srvConf := cfg.Load().HttpServer
+
+	netListener, err := net.Listen("tcp", srvConf.ListenAddress)
 	if err != nil {
-		lgr.Fatal().Err(err).Msgf("failed to start listener for http server on %s", cfg.HttpServer.ListenAddress)
+		lgr.Fatal().Err(err).Msgf("failed to start listener for http server on %s", srvConf.ListenAddress)
 	}
-	lgr.Debug().Msgf("start listener for http server success on %s", cfg.HttpServer.ListenAddress)
+	lgr.Debug().Msgf("start listener for http server success on %s", srvConf.ListenAddress)
 
 	server := &Server{
 		cfg: cfg,
 		lgr: lgr,
 		httpServer: &http.Server{
-			ReadTimeout:       30 * time.Second,
-			ReadHeaderTimeout: 30 * time.Second,
-			WriteTimeout:      30 * time.Second,
-			IdleTimeout:       30 * time.Second,
+			ReadTimeout:       time.Duration(srvConf.ReadTimeout),
+			ReadHeaderTimeout: time.Duration(srvConf.ReadHeaderTimeout),
+			WriteTimeout:      time.Duration(srvConf.WriteTimeout),
+			IdleTimeout:       time.Duration(srvConf.IdleTimeout),
+			Handler:           NewRouter(handler),
 		},
 	}
 
+	serve := func() error {
+		return server.httpServer.Serve(netListener)
+	}
+	if srvConf.TLS.Enabled {
+		server.httpServer.TLSConfig, err = newTLSConfig(srvConf.TLS, lgr)
+		if err != nil {
+			lgr.Fatal().Err(err).Msg("failed to set up tls for http server")
+		}
+		serve = func() error {
+			// The certificate comes from TLSConfig.GetCertificate.
+			return server.httpServer.ServeTLS(netListener, "", "")
+		}
+	}
+
+	listenErrCh := make(chan error, 1)
+	go func() {
+		listenErrCh <- serve()
+	}()
+
+	return server, listenErrCh
+}
+
+// NewRouter routes every endpoint to handler, behind the access log and
+// CORS.
+func NewRouter(handler *handlers.Handler) http.Handler {
 	router := httprouter.New()
 	router.RedirectFixedPath = true
 	router.RedirectTrailingSlash = true
+	router.GlobalOPTIONS = http.HandlerFunc(handler.Preflight)
 
-	router.POST("/authors", handler.Middlware(handler.AddAuthor))
-	router.GET("/authors", handler.Middlware(handler.ListAuthors))
-	router.PUT("/authors/:id", handler.Middlware(handler.UpdateAuthor))
-	router.DELETE("/authors/:id", handler.Middlware(handler.DeleteAuthor))
+	handle := func(method, path string, h httprouter.Handle) {
+		router.Handle(method, path, handler.Middlware(path, h))
+	}
+	// api routes need credentials when authentication is enabled, and are
+	// rate limited by address before authentication and by client after.
+	api := func(method, path string, h httprouter.Handle) {
+		handle(method, path, handler.Throttle(path, handler.Authenticate(handler.RateLimit(path, h))))
+	}
 
-	router.POST("/posts", handler.Middlware(handler.AddPost))
-	router.GET("/posts", handler.Middlware(handler.ListPosts))
-	router.PUT("/posts/:id", handler.Middlware(handler.UpdatePost))
-	router.DELETE("/posts/:id", handler.Middlware(handler.DeletePost))
+	handle(http.MethodGet, "/healthz", handler.Healthz)
+	handle(http.MethodGet, "/readyz", handler.Readyz)
+	router.GET("/metrics", handler.Metrics)
 
-	server.httpServer.Handler = router
+	handle(http.MethodGet, "/admin/log-level", handler.Admin(handler.GetLogLevel))
+	handle(http.MethodPut, "/admin/log-level", handler.Admin(handler.SetLogLevel))
 
-	listenErrCh := make(chan error, 1)
-	go func() {
-		listenErrCh <- server.httpServer.Serve(netListener)
-	}()
+	api(http.MethodPost, "/authors", handler.AddAuthor)
+	api(http.MethodGet, "/authors", handler.ListAuthors)
+	api(http.MethodGet, "/authors/:id", handler.GetAuthor)
+	api(http.MethodGet, "/authors/:id/posts", handler.ListAuthorPosts)
+	api(http.MethodPut, "/authors/:id", handler.UpdateAuthor)
+	api(http.MethodPatch, "/authors/:id", handler.PatchAuthor)
+	api(http.MethodDelete, "/authors/:id", handler.DeleteAuthor)
 
-	return server, listenErrCh
+	api(http.MethodPost, "/posts", handler.AddPost)
+	api(http.MethodGet, "/posts", handler.ListPosts)
+	api(http.MethodGet, "/posts/:id", handler.GetPost)
+	api(http.MethodPut, "/posts/:id", handler.UpdatePost)
+	api(http.MethodPatch, "/posts/:id", handler.PatchPost)
+	api(http.MethodDelete, "/posts/:id", handler.DeletePost)
+
+	return handler.AccessLog(handler.CORS(router))
 }
 
 func (srv *Server) Shutdown() error {
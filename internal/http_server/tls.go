@@ -0,0 +1,48 @@
+package http_server
+
+import (
+	"crud/internal/config"
+	"crud/pkg/tlscert"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/rs/zerolog"
+	"os"
+	"time"
+)
+
+// newTLSConfig serves the certificate of cfg, reloaded when its files
+// change. With a client CA bundle, client certificates are verified against
+// it.
+func newTLSConfig(cfg config.TLSConfig, lgr zerolog.Logger) (*tls.Config, error) {
+	certs, err := tlscert.NewReloader(cfg.CertFile, cfg.KeyFile, time.Duration(cfg.ReloadInterval),
+		func(err error) {
+			lgr.Error().Err(err).Msg("keeping the previous tls certificate")
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     cfg.Version(),
+		CipherSuites:   cfg.Suites(),
+	}
+	if cfg.ClientCAFile == "" {
+		return tlsCfg, nil
+	}
+
+	bundle, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg.ClientCAs = x509.NewCertPool()
+	if !tlsCfg.ClientCAs.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificate found in %s", cfg.ClientCAFile)
+	}
+	tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if cfg.ClientAuth == config.ClientAuthOptional {
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,69 @@
+// Package requestid carries the id of a request, the x-request-id header, to
+// the calls made on its behalf: outgoing HTTP requests and database
+// statements, so that their logs can be joined with the request's.
+package requestid
+
+import (
+	"context"
+	"crud/internal/constants"
+	"net/http"
+	"regexp"
+)
+
+// commentSafe ids can go into a database comment as they are, whatever
+// pattern incoming ids were checked against.
+var commentSafe = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+func FromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	return requestId
+}
+
+func NewContext(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, constants.RequestIdKey, requestId)
+}
+
+// Comment returns "request_id=<id>" for database comments, or "" if ctx has
+// no request id or one that could end the comment.
+func Comment(ctx context.Context) string {
+	requestId := FromContext(ctx)
+	if !commentSafe.MatchString(requestId) {
+		return ""
+	}
+	return "request_id=" + requestId
+}
+
+// Transport adds the request id of a request's context to it. Base is
+// http.DefaultTransport if nil.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base()
+
+	requestId := FromContext(req.Context())
+	if requestId == "" {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	req.Header.Set(constants.RequestIdKey, requestId)
+
+	return base.RoundTrip(req)
+}
+
+// CloseIdleConnections lets http.Client.CloseIdleConnections reach Base.
+func (t *Transport) CloseIdleConnections() {
+	if closer, ok := t.base().(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
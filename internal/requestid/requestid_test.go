@@ -0,0 +1,48 @@
+package requestid_test
+
+import (
+	"context"
+	"crud/internal/requestid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestComment(t *testing.T) {
+	for id, want := range map[string]string{
+		"":                                     "",
+		"0f8fad5b-d9cb-469f-a165-70867728950e": "request_id=0f8fad5b-d9cb-469f-a165-70867728950e",
+		"gw:1.2_3":                             "request_id=gw:1.2_3",
+		"x */ DROP TABLE posts; /*":            "",
+		"a\nb":                                 "",
+	} {
+		ctx := requestid.NewContext(context.Background(), id)
+		if got := requestid.Comment(ctx); got != want {
+			t.Errorf("%q: got %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &requestid.Transport{}}
+	ctx := requestid.NewContext(context.Background(), "abc-123")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got.Get("X-Request-Id") != "abc-123" {
+		t.Errorf("x-request-id %q, want abc-123", got.Get("X-Request-Id"))
+	}
+	if req.Header.Get("X-Request-Id") != "" {
+		t.Error("the caller's request was modified")
+	}
+}
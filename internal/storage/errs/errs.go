@@ -0,0 +1,80 @@
+// Package errs holds the errors shared by every storage backend. It lives
+// apart from package storage so that the backends can import it.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of storage failures. Backends never return them bare: they wrap them
+// in *Error, and callers test for them with errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrForeignKey   = errors.New("foreign key violation")
+	ErrInvalid      = errors.New("invalid data")
+	ErrUnavailable  = errors.New("storage unavailable")
+	ErrPrecondition = errors.New("version mismatch")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Error is a classified storage error. Msg is safe to show to API clients,
+// while Err keeps the driver error for the logs.
+type Error struct {
+	Kind error
+	Msg  string
+	Err  error
+}
+
+func New(kind error, msg string) *Error {
+	return &Error{Kind: kind, Msg: msg}
+}
+
+func Wrap(kind error, msg string, err error) *Error {
+	return &Error{Kind: kind, Msg: msg, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ReferencedAuthor and MissingAuthor report posts_author_id_fk violations.
+// The messages match the constraint detail Postgres gives, so that every
+// backend answers API clients the same way.
+func ReferencedAuthor(authorId uint64) *Error {
+	return New(ErrForeignKey, fmt.Sprintf("violates foreign key constraint posts_author_id_fk: "+
+		"Key (id)=(%d) is still referenced from table \"posts\".", authorId))
+}
+
+func MissingAuthor(authorId uint64) *Error {
+	return New(ErrForeignKey, fmt.Sprintf("violates foreign key constraint posts_author_id_fk: "+
+		"Key (author_id)=(%d) is not present in table \"authors\".", authorId))
+}
+
+// StaleVersion reports a conditional write whose expected version is not the
+// stored one any more.
+func StaleVersion(entity string, id, version uint64) *Error {
+	return New(ErrPrecondition, fmt.Sprintf("%s %d is no longer at version %d", entity, id, version))
+}
+
+// Message returns the client-safe part of err, or "" if err was not
+// classified by a backend.
+func Message(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Msg
+	}
+	return ""
+}
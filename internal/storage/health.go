@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+)
+
+// Check is the state of one dependency. /readyz only answers whether it is
+// ok, the error and details are for the logs.
+type Check struct {
+	Ok      bool                   `json:"ok"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Checks pings the database and reports the pool saturation and the schema
+// version. The memory database only has the first check.
+func (s *Storage) Checks(ctx context.Context) map[string]Check {
+	checks := map[string]Check{
+		"database": s.checkDatabase(ctx),
+	}
+
+	switch {
+	case s.pgConn != nil:
+		stat := s.pgConn.Stat()
+		checks["pool"] = poolCheck(int64(stat.AcquiredConns()), int64(stat.MaxConns()), map[string]interface{}{
+			"acquired": stat.AcquiredConns(),
+			"idle":     stat.IdleConns(),
+			"total":    stat.TotalConns(),
+			"max":      stat.MaxConns(),
+		})
+	case s.mgPool != nil:
+		stat := s.mgPool.Stat()
+		checks["pool"] = poolCheck(stat.InUse, int64(stat.Max), map[string]interface{}{
+			"in_use": stat.InUse,
+			"open":   stat.Open,
+			"max":    stat.Max,
+		})
+	}
+
+	if s.migrator != nil {
+		checks["migrations"] = s.checkMigrations(ctx)
+	}
+
+	return checks
+}
+
+func (s *Storage) checkDatabase(ctx context.Context) Check {
+	var err error
+	switch {
+	case s.pgConn != nil:
+		err = s.pgConn.Ping(ctx)
+	case s.mgClient != nil:
+		err = s.mgClient.Ping(ctx, nil)
+	}
+	if err != nil {
+		return Check{Error: err.Error()}
+	}
+	return Check{Ok: true}
+}
+
+// poolCheck reports whether every connection is in use, so that new requests
+// wait for one. It never fails: a busy instance is still ready, taking it out
+// of rotation would only move its load to the others. A max of zero means an
+// unbounded pool.
+func poolCheck(inUse, max int64, details map[string]interface{}) Check {
+	details["saturated"] = max > 0 && inUse >= max
+	return Check{Ok: true, Details: details}
+}
+
+func (s *Storage) checkMigrations(ctx context.Context) Check {
+	status, err := s.migrator.Status(ctx)
+	if err != nil {
+		return Check{Error: err.Error()}
+	}
+
+	details := map[string]interface{}{
+		"current": status.Current,
+		"latest":  status.Latest,
+	}
+	if err = status.Mismatch(); err != nil {
+		return Check{Error: err.Error(), Details: details}
+	}
+	return Check{Ok: true, Details: details}
+}
+
+// PoolStats describes the connection pool of the database, nil for the
+// memory database.
+func (s *Storage) PoolStats() map[string]interface{} {
+	switch {
+	case s.pgConn != nil:
+		stat := s.pgConn.Stat()
+		return map[string]interface{}{
+			"acquired":               stat.AcquiredConns(),
+			"idle":                   stat.IdleConns(),
+			"constructing":           stat.ConstructingConns(),
+			"total":                  stat.TotalConns(),
+			"max":                    stat.MaxConns(),
+			"acquire_count":          stat.AcquireCount(),
+			"acquire_duration":       stat.AcquireDuration().String(),
+			"empty_acquire_count":    stat.EmptyAcquireCount(),
+			"canceled_acquire_count": stat.CanceledAcquireCount(),
+		}
+	case s.mgPool != nil:
+		stat := s.mgPool.Stat()
+		return map[string]interface{}{
+			"in_use": stat.InUse,
+			"open":   stat.Open,
+			"max":    stat.Max,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"crud/internal/entities"
+	"crud/internal/storage/mongo"
+	"crud/internal/storage/query"
+	"crud/pkg/metrics"
+	"crud/pkg/tracing"
+	"errors"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// errorKinds names the error kinds in the errors metric. Unclassified
+// errors are "internal".
+var errorKinds = []struct {
+	kind error
+	name string
+}{
+	{ErrNotFound, "not_found"},
+	{ErrConflict, "conflict"},
+	{ErrForeignKey, "foreign_key"},
+	{ErrInvalid, "invalid"},
+	{ErrUnavailable, "unavailable"},
+	{ErrPrecondition, "precondition"},
+}
+
+// instrument times and traces every storage call, by the "model" and "api"
+// labels the backends log with.
+type instrument struct {
+	db       string
+	tracer   *tracing.Tracer
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+func newInstrument(db string, reg *metrics.Registry, tracer *tracing.Tracer) *instrument {
+	return &instrument{
+		db:     db,
+		tracer: tracer,
+		duration: reg.Histogram("storage_call_duration_seconds",
+			"Duration of storage calls.", nil, "model", "api"),
+		errors: reg.Counter("storage_call_errors_total",
+			"Storage calls that failed, by error kind.", "model", "api", "kind"),
+	}
+}
+
+// start starts the span of a call. The backend gets the returned context,
+// so that its logs carry the span id, and done gets the call's error.
+func (in *instrument) start(ctx context.Context, model, api string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := in.tracer.Start(ctx, model+"."+api, tracing.KindClient)
+	span.SetAttr("db.system", in.db)
+	span.SetAttr("model", model)
+	span.SetAttr("api", api)
+
+	return ctx, func(err error) {
+		in.duration.Observe(time.Since(start).Seconds(), model, api)
+		if err != nil {
+			in.errors.Inc(model, api, errorKind(err))
+			span.SetError(err)
+		}
+		span.End()
+	}
+}
+
+func errorKind(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			return k.name
+		}
+	}
+	return "internal"
+}
+
+type instrumentedAuthors struct {
+	next IAuthors
+	*instrument
+}
+
+func (a instrumentedAuthors) Add(ctx context.Context, author *entities.Author) (err error) {
+	ctx, done := a.start(ctx, "authors", "Add")
+	defer func() { done(err) }()
+	return a.next.Add(ctx, author)
+}
+
+func (a instrumentedAuthors) List(ctx context.Context, opts query.Options) (_ []entities.Author, _ string, err error) {
+	ctx, done := a.start(ctx, "authors", "List")
+	defer func() { done(err) }()
+	return a.next.List(ctx, opts)
+}
+
+func (a instrumentedAuthors) Get(ctx context.Context, id uint64) (_ *entities.Author, err error) {
+	ctx, done := a.start(ctx, "authors", "Get")
+	defer func() { done(err) }()
+	return a.next.Get(ctx, id)
+}
+
+func (a instrumentedAuthors) Update(ctx context.Context, author *entities.Author) (err error) {
+	ctx, done := a.start(ctx, "authors", "Update")
+	defer func() { done(err) }()
+	return a.next.Update(ctx, author)
+}
+
+func (a instrumentedAuthors) Patch(ctx context.Context, id, version uint64, patch *entities.AuthorPatch) (_ *entities.Author, err error) {
+	ctx, done := a.start(ctx, "authors", "Patch")
+	defer func() { done(err) }()
+	return a.next.Patch(ctx, id, version, patch)
+}
+
+func (a instrumentedAuthors) Delete(ctx context.Context, id, version uint64) (err error) {
+	ctx, done := a.start(ctx, "authors", "Delete")
+	defer func() { done(err) }()
+	return a.next.Delete(ctx, id, version)
+}
+
+type instrumentedPosts struct {
+	next IPosts
+	*instrument
+}
+
+func (p instrumentedPosts) Add(ctx context.Context, post *entities.Post) (err error) {
+	ctx, done := p.start(ctx, "posts", "Add")
+	defer func() { done(err) }()
+	return p.next.Add(ctx, post)
+}
+
+func (p instrumentedPosts) List(ctx context.Context, opts query.Options) (_ []entities.Post, _ string, err error) {
+	ctx, done := p.start(ctx, "posts", "List")
+	defer func() { done(err) }()
+	return p.next.List(ctx, opts)
+}
+
+func (p instrumentedPosts) Get(ctx context.Context, id uint64) (_ *entities.Post, err error) {
+	ctx, done := p.start(ctx, "posts", "Get")
+	defer func() { done(err) }()
+	return p.next.Get(ctx, id)
+}
+
+func (p instrumentedPosts) Update(ctx context.Context, post *entities.Post) (err error) {
+	ctx, done := p.start(ctx, "posts", "Update")
+	defer func() { done(err) }()
+	return p.next.Update(ctx, post)
+}
+
+func (p instrumentedPosts) Patch(ctx context.Context, id, version uint64, patch *entities.PostPatch) (_ *entities.Post, err error) {
+	ctx, done := p.start(ctx, "posts", "Patch")
+	defer func() { done(err) }()
+	return p.next.Patch(ctx, id, version, patch)
+}
+
+func (p instrumentedPosts) Delete(ctx context.Context, id, version uint64) (err error) {
+	ctx, done := p.start(ctx, "posts", "Delete")
+	defer func() { done(err) }()
+	return p.next.Delete(ctx, id, version)
+}
+
+// registerPgPool exports pgxpool.Stat on every scrape.
+func registerPgPool(reg *metrics.Registry, pool *pgxpool.Pool) {
+	gauge := func(name, help string, value func(*pgxpool.Stat) float64) {
+		reg.GaugeFunc(name, help, func(emit func(float64, ...string)) {
+			emit(value(pool.Stat()))
+		})
+	}
+	counter := func(name, help string, value func(*pgxpool.Stat) float64) {
+		reg.CounterFunc(name, help, func(emit func(float64, ...string)) {
+			emit(value(pool.Stat()))
+		})
+	}
+
+	gauge("pgxpool_acquired_conns", "Connections currently in use.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("pgxpool_idle_conns", "Idle connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	gauge("pgxpool_constructing_conns", "Connections being established.",
+		func(s *pgxpool.Stat) float64 { return float64(s.ConstructingConns()) })
+	gauge("pgxpool_total_conns", "Connections in the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("pgxpool_max_conns", "Maximum size of the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	counter("pgxpool_acquire_count_total", "Successful connection acquisitions.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("pgxpool_acquire_duration_seconds_total", "Time spent acquiring connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+	counter("pgxpool_empty_acquire_count_total", "Acquisitions that waited for a connection.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("pgxpool_canceled_acquire_count_total", "Acquisitions canceled by their context.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+}
+
+// registerMongoPool exports the connection counts of the Mongo client.
+func registerMongoPool(reg *metrics.Registry, pool *mongo.Pool) {
+	reg.GaugeFunc("mongo_pool_in_use_conns", "Connections currently checked out.",
+		func(emit func(float64, ...string)) { emit(float64(pool.Stat().InUse)) })
+	reg.GaugeFunc("mongo_pool_open_conns", "Open connections.",
+		func(emit func(float64, ...string)) { emit(float64(pool.Stat().Open)) })
+	reg.GaugeFunc("mongo_pool_max_conns", "Maximum size of the pool, 0 if unbounded.",
+		func(emit func(float64, ...string)) { emit(float64(pool.Stat().Max)) })
+}
@@ -0,0 +1,262 @@
+package memory
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/constants"
+	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/tracing"
+	"fmt"
+	"github.com/rs/zerolog"
+)
+
+type Authors struct {
+	Model
+}
+
+func NewAuthors(cfg *config.Snapshot, lgr zerolog.Logger, db *DB) *Authors {
+	lgr = lgr.With().Str("model", "authors").Logger()
+
+	return &Authors{
+		Model: Model{
+			cfg: cfg,
+			lgr: lgr,
+			db:  db,
+		},
+	}
+}
+
+func (a *Authors) Add(ctx context.Context, author *entities.Author) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Add").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Str("name", author.Name),
+		).Logger()
+
+	if err = ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+
+	a.db.mu.Lock()
+	author.Id = a.db.nextAuthorId()
+	author.Version = 1
+	a.db.authors[author.Id] = *author
+	a.db.mu.Unlock()
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
+
+func (a *Authors) List(ctx context.Context, opts query.Options) ([]entities.Author, string, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "List").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Logger()
+
+	if err := ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, "", err
+	}
+
+	opts = opts.Normalize()
+
+	a.db.mu.RLock()
+	authors := make([]entities.Author, 0, len(a.db.authors))
+	for _, author := range a.db.authors {
+		authors = append(authors, author)
+	}
+	a.db.mu.RUnlock()
+
+	var after *entities.Author
+	if opts.After != nil {
+		last := cursorAuthor(opts.After)
+		after = &last
+	}
+	authors, next := page(authors, opts,
+		func(x, y entities.Author) int { return compareAuthors(opts.Sort, x, y) },
+		after,
+		func(author entities.Author) *query.Cursor { return query.AuthorCursor(opts, author) },
+	)
+
+	lgr.Debug().Msg("executed")
+
+	return authors, next, nil
+}
+
+func (a *Authors) Get(ctx context.Context, id uint64) (*entities.Author, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Get").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id),
+		).Logger()
+
+	if err := ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, err
+	}
+
+	a.db.mu.RLock()
+	author, ok := a.db.authors[id]
+	a.db.mu.RUnlock()
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", id))
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return &author, nil
+}
+
+func (a *Authors) Update(ctx context.Context, author *entities.Author) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Update").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", author.Id).
+			Str("name", author.Name).
+			Uint64("version", author.Version),
+		).Logger()
+
+	if err = ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	current, ok := a.db.authors[author.Id]
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", author.Id))
+	}
+	if author.Version != 0 && author.Version != current.Version {
+		lgr.Debug().Uint64("current_version", current.Version).Msg("version mismatch")
+		return errs.StaleVersion("author", author.Id, author.Version)
+	}
+	author.Version = current.Version + 1
+	a.db.authors[author.Id] = *author
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
+
+func (a *Authors) Patch(ctx context.Context, id, version uint64, patch *entities.AuthorPatch) (*entities.Author, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Patch").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version).
+			Strs("fields", patch.Fields()),
+		).Logger()
+
+	if err := ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, err
+	}
+
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	author, ok := a.db.authors[id]
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", id))
+	}
+	if version != 0 && version != author.Version {
+		lgr.Debug().Uint64("current_version", author.Version).Msg("version mismatch")
+		return nil, errs.StaleVersion("author", id, version)
+	}
+	if patch.Empty() {
+		lgr.Debug().Msg("executed")
+		return &author, nil
+	}
+	if patch.Name != nil {
+		author.Name = *patch.Name
+	}
+	author.Version++
+	a.db.authors[id] = author
+
+	lgr.Debug().Msg("executed")
+
+	return &author, nil
+}
+
+func (a *Authors) Delete(ctx context.Context, id, version uint64) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Delete").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version),
+		).Logger()
+
+	if err = ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	author, ok := a.db.authors[id]
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", id))
+	}
+	if version != 0 && version != author.Version {
+		lgr.Debug().Uint64("current_version", author.Version).Msg("version mismatch")
+		return errs.StaleVersion("author", id, version)
+	}
+	switch a.cfg.Load().Database.AuthorDeletePolicy {
+	case config.DeleteCascade:
+		for postId, post := range a.db.posts {
+			if post.AuthorId == id {
+				delete(a.db.posts, postId)
+			}
+		}
+	case config.DeleteOrphan:
+		for postId, post := range a.db.posts {
+			if post.AuthorId == id {
+				post.AuthorId = 0
+				post.Version++
+				a.db.posts[postId] = post
+			}
+		}
+	default:
+		for _, post := range a.db.posts {
+			if post.AuthorId == id {
+				err = errs.ReferencedAuthor(id)
+				lgr.Error().Err(err).Msg("db query failed")
+				return err
+			}
+		}
+	}
+	delete(a.db.authors, id)
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
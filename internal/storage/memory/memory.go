@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"crud/internal/config"
+	"crud/internal/entities"
+	"github.com/rs/zerolog"
+	"sync"
+)
+
+// DB is an in-process replacement for the authors/posts schema. Tables and
+// sequences are shared between the models so that posts.author_id can be
+// checked against authors the same way posts_author_id_fk does.
+type DB struct {
+	mu sync.RWMutex
+
+	authors    map[uint64]entities.Author
+	posts      map[uint64]entities.Post
+	authorsSeq uint64
+	postsSeq   uint64
+}
+
+func NewDB(cfg *config.Snapshot, lgr zerolog.Logger) *DB {
+	lgr = lgr.With().Str("db", "memory").Logger()
+
+	db := &DB{
+		authors: make(map[uint64]entities.Author),
+		posts:   make(map[uint64]entities.Post),
+	}
+
+	lgr.Debug().Msg("database created")
+
+	return db
+}
+
+// nextAuthorId and nextPostId behave like nextval(): the value is consumed
+// even if the statement using it fails later, so ids are never reused.
+func (db *DB) nextAuthorId() uint64 {
+	db.authorsSeq++
+	return db.authorsSeq
+}
+
+func (db *DB) nextPostId() uint64 {
+	db.postsSeq++
+	return db.postsSeq
+}
+
+type Model struct {
+	cfg *config.Snapshot
+	lgr zerolog.Logger
+	db  *DB
+}
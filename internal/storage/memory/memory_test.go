@@ -0,0 +1,39 @@
+package memory_test
+
+import (
+	"crud/internal/config"
+	"crud/internal/storage"
+	"crud/internal/storage/memory"
+	"crud/internal/storage/storagetest"
+	"github.com/rs/zerolog"
+	"testing"
+)
+
+func factory(policy string) storagetest.Factory {
+	return func(t *testing.T) *storage.Storage {
+		cfg := config.NewSnapshot(&config.Config{Database: config.DatabaseConfig{Name: "memory", AuthorDeletePolicy: policy}})
+		lgr := zerolog.Nop()
+
+		db := memory.NewDB(cfg, lgr)
+		return &storage.Storage{
+			Authors: memory.NewAuthors(cfg, lgr, db),
+			Posts:   memory.NewPosts(cfg, lgr, db),
+		}
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	storagetest.RunAuthors(t, factory(config.DeleteRestrict))
+}
+
+func TestPosts(t *testing.T) {
+	storagetest.RunPosts(t, factory(config.DeleteRestrict))
+}
+
+func TestDeletePolicy(t *testing.T) {
+	for _, policy := range []string{config.DeleteRestrict, config.DeleteCascade, config.DeleteOrphan} {
+		t.Run(policy, func(t *testing.T) {
+			storagetest.RunDeletePolicy(t, policy, factory(policy))
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package memory
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/constants"
+	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/tracing"
+	"fmt"
+	"github.com/rs/zerolog"
+)
+
+type Posts struct {
+	Model
+}
+
+func NewPosts(cfg *config.Snapshot, lgr zerolog.Logger, db *DB) *Posts {
+	lgr = lgr.With().Str("model", "posts").Logger()
+
+	return &Posts{
+		Model: Model{
+			cfg: cfg,
+			lgr: lgr,
+			db:  db,
+		},
+	}
+}
+
+func (p *Posts) Add(ctx context.Context, post *entities.Post) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Add").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("author_id", post.AuthorId).
+			Str("title", post.Title).
+			Str("content", post.Content).
+			Time("created_at", post.CreatedAt),
+		).Logger()
+
+	if err = ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	id := p.db.nextPostId()
+	if _, ok := p.db.authors[post.AuthorId]; !ok {
+		err = errs.MissingAuthor(post.AuthorId)
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+	post.Id = id
+	post.Version = 1
+	p.db.posts[post.Id] = *post
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
+
+func (p *Posts) List(ctx context.Context, opts query.Options) ([]entities.Post, string, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "List").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Logger()
+
+	if err := ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, "", err
+	}
+
+	opts = opts.Normalize()
+
+	p.db.mu.RLock()
+	posts := make([]entities.Post, 0, len(p.db.posts))
+	for _, post := range p.db.posts {
+		if matchPost(opts.Filter, post) {
+			posts = append(posts, post)
+		}
+	}
+	p.db.mu.RUnlock()
+
+	var after *entities.Post
+	if opts.After != nil {
+		last := cursorPost(opts.After)
+		after = &last
+	}
+	posts, next := page(posts, opts,
+		func(x, y entities.Post) int { return comparePosts(opts.Sort, x, y) },
+		after,
+		func(post entities.Post) *query.Cursor { return query.PostCursor(opts, post) },
+	)
+
+	lgr.Debug().Msg("executed")
+
+	return posts, next, nil
+}
+
+func (p *Posts) Get(ctx context.Context, id uint64) (*entities.Post, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Get").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id),
+		).Logger()
+
+	if err := ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, err
+	}
+
+	p.db.mu.RLock()
+	post, ok := p.db.posts[id]
+	p.db.mu.RUnlock()
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("post %d not found", id))
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return &post, nil
+}
+
+func (p *Posts) Update(ctx context.Context, post *entities.Post) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Update").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", post.Id).
+			Uint64("author_id", post.AuthorId).
+			Str("title", post.Title).
+			Str("content", post.Content).
+			Time("created_at", post.CreatedAt).
+			Uint64("version", post.Version),
+		).Logger()
+
+	if err = ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	current, ok := p.db.posts[post.Id]
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("post %d not found", post.Id))
+	}
+	if post.Version != 0 && post.Version != current.Version {
+		lgr.Debug().Uint64("current_version", current.Version).Msg("version mismatch")
+		return errs.StaleVersion("post", post.Id, post.Version)
+	}
+	if _, ok := p.db.authors[post.AuthorId]; !ok {
+		err = errs.MissingAuthor(post.AuthorId)
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+	post.Version = current.Version + 1
+	p.db.posts[post.Id] = *post
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
+
+func (p *Posts) Patch(ctx context.Context, id, version uint64, patch *entities.PostPatch) (*entities.Post, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Patch").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version).
+			Strs("fields", patch.Fields()),
+		).Logger()
+
+	if err := ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, err
+	}
+
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	post, ok := p.db.posts[id]
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("post %d not found", id))
+	}
+	if version != 0 && version != post.Version {
+		lgr.Debug().Uint64("current_version", post.Version).Msg("version mismatch")
+		return nil, errs.StaleVersion("post", id, version)
+	}
+	if patch.Empty() {
+		lgr.Debug().Msg("executed")
+		return &post, nil
+	}
+	if patch.AuthorId != nil {
+		if _, ok = p.db.authors[*patch.AuthorId]; !ok {
+			err := errs.MissingAuthor(*patch.AuthorId)
+			lgr.Error().Err(err).Msg("db query failed")
+			return nil, err
+		}
+		post.AuthorId = *patch.AuthorId
+	}
+	if patch.Title != nil {
+		post.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		post.Content = *patch.Content
+	}
+	if patch.CreatedAt != nil {
+		post.CreatedAt = *patch.CreatedAt
+	}
+	post.Version++
+	p.db.posts[id] = post
+
+	lgr.Debug().Msg("executed")
+
+	return &post, nil
+}
+
+func (p *Posts) Delete(ctx context.Context, id, version uint64) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Delete").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version),
+		).Logger()
+
+	if err = ctx.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return err
+	}
+
+	p.db.mu.Lock()
+	defer p.db.mu.Unlock()
+
+	post, ok := p.db.posts[id]
+	if !ok {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("post %d not found", id))
+	}
+	if version != 0 && version != post.Version {
+		lgr.Debug().Uint64("current_version", post.Version).Msg("version mismatch")
+		return errs.StaleVersion("post", id, version)
+	}
+	delete(p.db.posts, id)
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
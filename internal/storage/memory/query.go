@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"crud/internal/entities"
+	"crud/internal/storage/query"
+	"sort"
+	"strings"
+)
+
+// compareAuthors orders two authors by the sort field, falling back to the id.
+func compareAuthors(sort string, a, b entities.Author) int {
+	if sort == query.SortName {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+	}
+	return compareIds(a.Id, b.Id)
+}
+
+func comparePosts(sort string, a, b entities.Post) int {
+	switch sort {
+	case query.SortTitle:
+		if c := strings.Compare(a.Title, b.Title); c != 0 {
+			return c
+		}
+	case query.SortCreatedAt:
+		if a.CreatedAt.Before(b.CreatedAt) {
+			return -1
+		}
+		if a.CreatedAt.After(b.CreatedAt) {
+			return 1
+		}
+	}
+	return compareIds(a.Id, b.Id)
+}
+
+func compareIds(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cursorAuthor and cursorPost rebuild the last row of the previous page from
+// the cursor, so it can be compared like any other row.
+func cursorAuthor(c *query.Cursor) entities.Author {
+	return entities.Author{Id: c.Id, Name: c.Str}
+}
+
+func cursorPost(c *query.Cursor) entities.Post {
+	post := entities.Post{Id: c.Id, Title: c.Str}
+	if c.Time != nil {
+		post.CreatedAt = *c.Time
+	}
+	return post
+}
+
+func matchPost(f query.Filter, post entities.Post) bool {
+	if f.AuthorId != 0 && post.AuthorId != f.AuthorId {
+		return false
+	}
+	if !f.CreatedFrom.IsZero() && post.CreatedAt.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !post.CreatedAt.Before(f.CreatedTo) {
+		return false
+	}
+	return strings.HasPrefix(post.Title, f.TitlePrefix)
+}
+
+// page sorts rows, skips everything up to and including the cursor and cuts
+// the result to the limit. It returns the cursor of the next page, or "" if
+// this one is the last.
+func page[T any](rows []T, opts query.Options, compare func(a, b T) int, after *T,
+	cursor func(T) *query.Cursor,
+) ([]T, string) {
+	if opts.Order == query.Desc {
+		asc := compare
+		compare = func(a, b T) int { return -asc(a, b) }
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return compare(rows[i], rows[j]) < 0 })
+
+	start := 0
+	if after != nil {
+		for start < len(rows) && compare(rows[start], *after) <= 0 {
+			start++
+		}
+	}
+	rows = rows[start:]
+
+	if len(rows) <= opts.Limit {
+		return rows, ""
+	}
+	rows = rows[:opts.Limit]
+	return rows, cursor(rows[len(rows)-1]).Encode()
+}
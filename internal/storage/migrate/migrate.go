@@ -0,0 +1,213 @@
+// Package migrate applies versioned schema changes. The engine is shared by
+// every backend, which provides its steps and keeps track of the applied ones
+// in a schema_migrations table or collection through a Driver.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"sort"
+)
+
+// ErrMismatch is returned by Check when the schema is not at the version this
+// build expects.
+var ErrMismatch = errors.New("schema version mismatch")
+
+// ErrLockLost is returned when the lock was lost while migrating, so another
+// process may be migrating too.
+var ErrLockLost = errors.New("migration lock lost")
+
+type Step struct {
+	Version uint
+	Name    string
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%04d_%s", s.Version, s.Name)
+}
+
+type Driver interface {
+	// Steps lists the migrations this build knows, in ascending version order.
+	Steps() []Step
+	// Lock blocks until no other process migrates the same database, or until
+	// ctx is done. The steps run with locked, which is done if the lock is
+	// lost before unlock releases it.
+	Lock(ctx context.Context) (locked context.Context, unlock func(), err error)
+	// Applied returns the versions recorded as applied, in ascending order.
+	Applied(ctx context.Context) ([]uint, error)
+	// Up applies a step and records it, Down reverts a step and forgets it.
+	Up(ctx context.Context, step Step) error
+	Down(ctx context.Context, step Step) error
+}
+
+type Status struct {
+	// Current is the highest applied version, 0 on an empty database.
+	Current uint
+	// Latest is the highest version this build knows.
+	Latest  uint
+	Applied []Step
+	Pending []Step
+	// Unknown lists applied versions this build doesn't know, which means
+	// the database was migrated by a newer one.
+	Unknown []uint
+}
+
+type Migrator struct {
+	drv Driver
+	lgr zerolog.Logger
+}
+
+func New(drv Driver, lgr zerolog.Logger) *Migrator {
+	return &Migrator{
+		drv: drv,
+		lgr: lgr.With().Str("component", "migrate").Logger(),
+	}
+}
+
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	applied, err := m.drv.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status(m.drv.Steps(), applied), nil
+}
+
+func status(steps []Step, applied []uint) *Status {
+	s := new(Status)
+
+	done := make(map[uint]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+		if version > s.Current {
+			s.Current = version
+		}
+	}
+
+	known := make(map[uint]bool, len(steps))
+	for _, step := range steps {
+		known[step.Version] = true
+		if step.Version > s.Latest {
+			s.Latest = step.Version
+		}
+		if done[step.Version] {
+			s.Applied = append(s.Applied, step)
+		} else {
+			s.Pending = append(s.Pending, step)
+		}
+	}
+	for _, version := range applied {
+		if !known[version] {
+			s.Unknown = append(s.Unknown, version)
+		}
+	}
+	sort.Slice(s.Unknown, func(i, j int) bool { return s.Unknown[i] < s.Unknown[j] })
+
+	return s
+}
+
+// Check returns ErrMismatch unless every known step is applied and nothing
+// else is.
+func (m *Migrator) Check(ctx context.Context) error {
+	s, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Mismatch()
+}
+
+// Mismatch is Check on an already read Status.
+func (s *Status) Mismatch() error {
+	if len(s.Unknown) > 0 {
+		return fmt.Errorf("%w: database has version %d, newer than %d known to this build",
+			ErrMismatch, s.Unknown[len(s.Unknown)-1], s.Latest)
+	}
+	if len(s.Pending) > 0 {
+		return fmt.Errorf("%w: database is at version %d, %d migration(s) up to %d pending",
+			ErrMismatch, s.Current, len(s.Pending), s.Latest)
+	}
+	return nil
+}
+
+// Up applies at most n pending steps, all of them when n <= 0, and returns
+// the applied ones.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Step, error) {
+	locked, unlock, err := m.drv.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Read the state only under the lock: another process may have just
+	// migrated.
+	s, err := m.Status(locked)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Unknown) > 0 {
+		return nil, fmt.Errorf("%w: database has version %d, newer than %d known to this build",
+			ErrMismatch, s.Unknown[len(s.Unknown)-1], s.Latest)
+	}
+
+	pending := s.Pending
+	if n > 0 && n < len(pending) {
+		pending = pending[:n]
+	}
+
+	done := make([]Step, 0, len(pending))
+	for _, step := range pending {
+		lgr := m.lgr.With().Str("migration", step.String()).Logger()
+		if err = m.drv.Up(locked, step); err != nil {
+			err = lockLost(ctx, locked, err)
+			lgr.Error().Err(err).Msg("migration failed")
+			return done, fmt.Errorf("migration %s: %w", step, err)
+		}
+		lgr.Info().Msg("migration applied")
+		done = append(done, step)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last n applied steps and returns them.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Step, error) {
+	locked, unlock, err := m.drv.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	s, err := m.Status(locked)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Unknown) > 0 {
+		return nil, fmt.Errorf("%w: database has version %d, which this build can't revert",
+			ErrMismatch, s.Unknown[len(s.Unknown)-1])
+	}
+
+	done := make([]Step, 0, n)
+	for i := len(s.Applied) - 1; i >= 0 && len(done) < n; i-- {
+		step := s.Applied[i]
+		lgr := m.lgr.With().Str("migration", step.String()).Logger()
+		if err = m.drv.Down(locked, step); err != nil {
+			err = lockLost(ctx, locked, err)
+			lgr.Error().Err(err).Msg("migration revert failed")
+			return done, fmt.Errorf("revert %s: %w", step, err)
+		}
+		lgr.Info().Msg("migration reverted")
+		done = append(done, step)
+	}
+
+	return done, nil
+}
+
+// lockLost replaces the error of a step cut short by the loss of the lock
+// with ErrLockLost.
+func lockLost(ctx, locked context.Context, err error) error {
+	if locked.Err() != nil && ctx.Err() == nil {
+		return ErrLockLost
+	}
+	return err
+}
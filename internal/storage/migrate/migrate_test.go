@@ -0,0 +1,168 @@
+package migrate_test
+
+import (
+	"context"
+	"crud/internal/storage/migrate"
+	"crud/internal/storage/storagetest"
+	"errors"
+	"github.com/rs/zerolog"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// driver keeps the applied versions in memory. The lock is a channel so that
+// waiting for it honours the context like the real ones do.
+type driver struct {
+	steps []migrate.Step
+	lock  chan struct{}
+	// loseAt makes Up lose the lock before applying that version.
+	loseAt uint
+
+	mu      sync.Mutex
+	applied map[uint]bool
+	lose    context.CancelFunc
+}
+
+func newDriver(steps ...migrate.Step) *driver {
+	return &driver{
+		steps:   steps,
+		lock:    make(chan struct{}, 1),
+		applied: make(map[uint]bool),
+	}
+}
+
+func (d *driver) Steps() []migrate.Step {
+	return d.steps
+}
+
+func (d *driver) Lock(ctx context.Context) (context.Context, func(), error) {
+	select {
+	case d.lock <- struct{}{}:
+		locked, cancel := context.WithCancel(ctx)
+		d.mu.Lock()
+		d.lose = cancel
+		d.mu.Unlock()
+		return locked, func() { cancel(); <-d.lock }, nil
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+func (d *driver) Applied(context.Context) ([]uint, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	versions := make([]uint, 0, len(d.applied))
+	for version := range d.applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
+func (d *driver) Up(ctx context.Context, step migrate.Step) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if step.Version == d.loseAt {
+		d.lose()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d.applied[step.Version] {
+		return errors.New("applied twice")
+	}
+	d.applied[step.Version] = true
+	return nil
+}
+
+func (d *driver) Down(_ context.Context, step migrate.Step) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.applied, step.Version)
+	return nil
+}
+
+var steps = []migrate.Step{{Version: 1, Name: "init"}, {Version: 2, Name: "second"}, {Version: 3, Name: "third"}}
+
+func TestMigrator(t *testing.T) {
+	storagetest.RunMigrations(t, migrate.New(newDriver(steps...), zerolog.Nop()))
+}
+
+func TestNewerDatabase(t *testing.T) {
+	drv := newDriver(steps...)
+	drv.applied[1], drv.applied[2], drv.applied[3], drv.applied[4] = true, true, true, true
+	m := migrate.New(drv, zerolog.Nop())
+	ctx := context.Background()
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Current != 4 || status.Latest != 3 || len(status.Unknown) != 1 {
+		t.Fatalf("Status: got %+v", status)
+	}
+
+	if err = m.Check(ctx); !errors.Is(err, migrate.ErrMismatch) {
+		t.Fatalf("Check: got %v, want %v", err, migrate.ErrMismatch)
+	}
+	if _, err = m.Up(ctx, 0); !errors.Is(err, migrate.ErrMismatch) {
+		t.Fatalf("Up: got %v, want %v", err, migrate.ErrMismatch)
+	}
+	if _, err = m.Down(ctx, 1); !errors.Is(err, migrate.ErrMismatch) {
+		t.Fatalf("Down: got %v, want %v", err, migrate.ErrMismatch)
+	}
+}
+
+func TestGap(t *testing.T) {
+	// A step merged from an older branch can land below the current version.
+	drv := newDriver(steps...)
+	drv.applied[1], drv.applied[3] = true, true
+	m := migrate.New(drv, zerolog.Nop())
+
+	applied, err := m.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != steps[1] {
+		t.Fatalf("Up applied %v, want %v", applied, steps[1:2])
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	drv := newDriver(steps...)
+	m := migrate.New(drv, zerolog.Nop())
+
+	_, unlock, _ := drv.Lock(context.Background())
+	defer unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Up(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Up while locked: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	drv := newDriver(steps...)
+	drv.loseAt = 2
+	m := migrate.New(drv, zerolog.Nop())
+
+	applied, err := m.Up(context.Background(), 0)
+	if !errors.Is(err, migrate.ErrLockLost) {
+		t.Fatalf("Up: got %v, want %v", err, migrate.ErrLockLost)
+	}
+	if len(applied) != 1 || applied[0] != steps[0] {
+		t.Fatalf("Up applied %v, want %v", applied, steps[:1])
+	}
+
+	// The lock was released, and the remaining steps are applied by the
+	// next run.
+	drv.loseAt = 0
+	if applied, err = m.Up(context.Background(), 0); err != nil || len(applied) != 2 {
+		t.Fatalf("Up after the lock was lost: applied %v, %v", applied, err)
+	}
+}
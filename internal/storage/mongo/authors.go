@@ -5,19 +5,27 @@ import (
 	"crud/internal/config"
 	"crud/internal/constants"
 	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/tracing"
+	"errors"
+	"fmt"
 	"github.com/hendratommy/mongo-sequence/pkg/sequence"
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
 type Authors struct {
 	Model
-	coll *mongo.Collection
+	coll      *mongo.Collection
+	postsColl *mongo.Collection
 }
 
-func NewAuthors(cfg *config.Config, lgr zerolog.Logger, client *mongo.Client, seqColl *mongo.Collection) *Authors {
+func NewAuthors(cfg *config.Snapshot, lgr zerolog.Logger, client *mongo.Client, seqColl *mongo.Collection) *Authors {
 	return &Authors{
 		Model: Model{
 			cfg:     cfg,
@@ -25,7 +33,8 @@ func NewAuthors(cfg *config.Config, lgr zerolog.Logger, client *mongo.Client, se
 			client:  client,
 			seqColl: seqColl,
 		},
-		coll: client.Database(cfg.Mongo.DB).Collection("authors"),
+		coll:      client.Database(cfg.Load().Mongo.DB).Collection("authors"),
+		postsColl: client.Database(cfg.Load().Mongo.DB).Collection("posts"),
 	}
 }
 
@@ -34,7 +43,8 @@ func (a *Authors) Add(ctx context.Context, author *entities.Author) (err error)
 	lgr := a.lgr.With().
 		Str("api", "Add").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Str("name", author.Name),
 		).Logger()
 
@@ -44,14 +54,15 @@ func (a *Authors) Add(ctx context.Context, author *entities.Author) (err error)
 	seq, err := sequence.NextVal("authors_seq")
 	if err != nil {
 		lgr.Error().Err(err).Msg("db sequence failed")
-		return err
+		return translate(err)
 	}
 	author.Id = uint64(seq)
+	author.Version = 1
 
-	_, err = a.coll.InsertOne(ctx, author)
+	_, err = a.coll.InsertOne(ctx, author, options.InsertOne().SetComment(comment(ctx)))
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
 	}
 
 	lgr.Debug().Msg("executed")
@@ -59,36 +70,84 @@ func (a *Authors) Add(ctx context.Context, author *entities.Author) (err error)
 	return nil
 }
 
-func (a *Authors) List(ctx context.Context) ([]entities.Author, error) {
+func (a *Authors) List(ctx context.Context, opts query.Options) ([]entities.Author, string, error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := a.lgr.With().
 		Str("api", "List").
 		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
 		Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	cursor, err := a.coll.Find(ctx, bson.M{})
+	opts = opts.Normalize()
+
+	filter := bson.M{}
+	if opts.After != nil {
+		filter = after(filter, opts, opts.After.Str)
+	}
+
+	cursor, err := a.coll.Find(ctx, filter, findOptions(opts).SetComment(comment(ctx)))
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return nil, err
+		return nil, "", translate(err)
 	}
+	defer cursor.Close(ctx)
 
-	authors := make([]entities.Author, 0, 10)
-	for cursor.Next(context.TODO()) {
+	authors := make([]entities.Author, 0, opts.Limit+1)
+	for cursor.Next(ctx) {
 		author := entities.Author{}
 		err = cursor.Decode(&author)
 		if err != nil {
 			lgr.Error().Err(err).Msg("db scan failed")
-			return nil, err
+			return nil, "", translate(err)
 		}
 		authors = append(authors, author)
 	}
+	if err = cursor.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db scan failed")
+		return nil, "", translate(err)
+	}
+
+	var next string
+	if len(authors) > opts.Limit {
+		authors = authors[:opts.Limit]
+		next = query.AuthorCursor(opts, authors[len(authors)-1]).Encode()
+	}
 
 	lgr.Debug().Msg("executed")
 
-	return authors, nil
+	return authors, next, nil
+}
+
+func (a *Authors) Get(ctx context.Context, id uint64) (*entities.Author, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Get").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	author := new(entities.Author)
+	err := a.coll.FindOne(ctx, bson.M{"id": id}, options.FindOne().SetComment(comment(ctx))).Decode(author)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", id))
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return author, nil
 }
 
 func (a *Authors) Update(ctx context.Context, author *entities.Author) (err error) {
@@ -96,43 +155,110 @@ func (a *Authors) Update(ctx context.Context, author *entities.Author) (err erro
 	lgr := a.lgr.With().
 		Str("api", "Update").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("id", author.Id).
-			Str("name", author.Name),
+			Str("name", author.Name).
+			Uint64("version", author.Version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = a.coll.UpdateOne(ctx,
-		bson.M{"id": author.Id},
-		bson.M{"$set": bson.M{"name": author.Name}},
-	)
+	updated := entities.Author{}
+	err = a.coll.FindOneAndUpdate(ctx,
+		versioned(author.Id, author.Version),
+		bson.M{"$set": bson.M{"name": author.Name}, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"version": 1}).SetComment(comment(ctx)),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return unmatched(ctx, lgr, a.coll, "author", author.Id, author.Version)
+	}
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
 	}
+	author.Version = updated.Version
 
 	lgr.Debug().Msg("executed")
 
 	return nil
 }
 
-func (a *Authors) Delete(ctx context.Context, id uint64) (err error) {
+func (a *Authors) Patch(ctx context.Context, id, version uint64, patch *entities.AuthorPatch) (*entities.Author, error) {
+	if patch.Empty() {
+		author, err := a.Get(ctx, id)
+		if err == nil && version != 0 && version != author.Version {
+			return nil, errs.StaleVersion("author", id, version)
+		}
+		return author, err
+	}
+
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := a.lgr.With().
-		Str("api", "Delete").
+		Str("api", "Patch").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
-			Uint64("id", id),
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version).
+			Strs("fields", patch.Fields()),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = a.coll.DeleteOne(ctx, bson.M{"id": id})
+	set := bson.M{}
+	if patch.Name != nil {
+		set["name"] = *patch.Name
+	}
+
+	author := new(entities.Author)
+	err := a.coll.FindOneAndUpdate(ctx,
+		versioned(id, version),
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetComment(comment(ctx)),
+	).Decode(author)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, unmatched(ctx, lgr, a.coll, "author", id, version)
+	}
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return author, nil
+}
+
+func (a *Authors) Delete(ctx context.Context, id, version uint64) (err error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Delete").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	policy := a.cfg.Load().Database.AuthorDeletePolicy
+	err = a.transaction(ctx, func(sc mongo.SessionContext) error {
+		if policy == config.DeleteCascade || policy == config.DeleteOrphan {
+			return a.deleteWithPosts(sc, id, version, policy)
+		}
+		return a.deleteRestricted(sc, id, version)
+	})
+	if errors.Is(err, errs.ErrNotFound) || errors.Is(err, errs.ErrPrecondition) || errors.Is(err, errs.ErrForeignKey) {
+		lgr.Debug().Err(err).Msg("not deleted")
+		return err
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db transaction failed")
 		return err
 	}
 
@@ -140,3 +266,60 @@ func (a *Authors) Delete(ctx context.Context, id uint64) (err error) {
 
 	return nil
 }
+
+// deleteRestricted deletes an author who has no posts. Running in the same
+// transaction as the count, the delete conflicts with a post added for the
+// author meanwhile, see Posts.checkAuthor.
+func (a *Authors) deleteRestricted(sc mongo.SessionContext, id, version uint64) error {
+	// A stale version must win over the posts check, as it does with the
+	// other backends.
+	if version != 0 {
+		n, err := a.coll.CountDocuments(sc, versioned(id, version), options.Count().SetComment(comment(sc)))
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return unmatched(sc, a.lgr, a.coll, "author", id, version)
+		}
+	}
+
+	n, err := a.postsColl.CountDocuments(sc, bson.M{"author_id": id}, options.Count().SetComment(comment(sc)))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errs.ReferencedAuthor(id)
+	}
+
+	res, err := a.coll.DeleteOne(sc, versioned(id, version), options.Delete().SetComment(comment(sc)))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return unmatched(sc, a.lgr, a.coll, "author", id, version)
+	}
+	return nil
+}
+
+// deleteWithPosts applies the cascade or orphan policy and deletes the
+// author.
+func (a *Authors) deleteWithPosts(sc mongo.SessionContext, id, version uint64, policy string) error {
+	res, err := a.coll.DeleteOne(sc, versioned(id, version), options.Delete().SetComment(comment(sc)))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return unmatched(sc, a.lgr, a.coll, "author", id, version)
+	}
+
+	if policy == config.DeleteCascade {
+		_, err = a.postsColl.DeleteMany(sc, bson.M{"author_id": id}, options.Delete().SetComment(comment(sc)))
+	} else {
+		_, err = a.postsColl.UpdateMany(sc,
+			bson.M{"author_id": id},
+			bson.M{"$set": bson.M{"author_id": nil}, "$inc": bson.M{"version": 1}},
+			options.Update().SetComment(comment(sc)),
+		)
+	}
+	return err
+}
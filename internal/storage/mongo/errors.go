@@ -0,0 +1,36 @@
+package mongo
+
+import (
+	"context"
+	"crud/internal/storage/errs"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Server error codes, see
+// https://github.com/mongodb/mongo/blob/master/src/mongo/base/error_codes.yml.
+const (
+	documentValidationFailure = 121
+	writeConflict             = 112
+)
+
+// translate maps driver errors onto the storage error kinds.
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var srvErr mongo.ServerError
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return errs.Wrap(errs.ErrConflict, "duplicate key", err)
+	case mongo.IsTimeout(err), mongo.IsNetworkError(err), errors.Is(err, context.DeadlineExceeded):
+		return errs.Wrap(errs.ErrUnavailable, "database unavailable", err)
+	case errors.As(err, &srvErr) && srvErr.HasErrorCode(writeConflict):
+		return errs.Wrap(errs.ErrConflict, "concurrent update, retry the request", err)
+	case errors.As(err, &srvErr) && srvErr.HasErrorCode(documentValidationFailure):
+		return errs.Wrap(errs.ErrInvalid, "invalid value", err)
+	}
+
+	return err
+}
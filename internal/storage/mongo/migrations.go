@@ -0,0 +1,328 @@
+package mongo
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/storage/migrate"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// lockTTL bounds how long a crashed process can keep others from migrating.
+// A live process renews its lease every renewEvery while the steps run.
+const (
+	lockTTL    = 10 * time.Minute
+	renewEvery = lockTTL / 3
+)
+
+type migration struct {
+	migrate.Step
+	up, down func(ctx context.Context, db *mongo.Database) error
+}
+
+// migrations can't run in a transaction without a replica set, so every step
+// must be safe to run again after a failure.
+var migrations = []migration{
+	{
+		Step: migrate.Step{Version: 1, Name: "init"},
+		up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"authors", "posts"} {
+				if err := createCollection(ctx, db, name); err != nil {
+					return err
+				}
+			}
+			_, err := db.Collection("authors").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("posts").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "author_id", Value: 1}}},
+			})
+			return err
+		},
+		down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"posts", "authors"} {
+				if err := db.Collection(name).Drop(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Step: migrate.Step{Version: 2, Name: "versions"},
+		up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"authors", "posts"} {
+				_, err := db.Collection(name).UpdateMany(ctx,
+					bson.M{"version": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"version": 1}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range []string{"authors", "posts"} {
+				_, err := db.Collection(name).UpdateMany(ctx,
+					bson.M{},
+					bson.M{"$unset": bson.M{"version": ""}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Posts written before the bson tags stored these fields under the
+		// lowercased Go names.
+		Step: migrate.Step{Version: 3, Name: "post_field_names"},
+		up: func(ctx context.Context, db *mongo.Database) error {
+			return renameFields(ctx, db.Collection("posts"), bson.M{"authorid": "author_id", "createdat": "created_at"})
+		},
+		down: func(ctx context.Context, db *mongo.Database) error {
+			return renameFields(ctx, db.Collection("posts"), bson.M{"author_id": "authorid", "created_at": "createdat"})
+		},
+	},
+}
+
+// renameFields renames the fields of every document that has one of the old
+// names. Renaming a missing field does nothing, so it can run again.
+func renameFields(ctx context.Context, coll *mongo.Collection, names bson.M) error {
+	var has bson.A
+	for old := range names {
+		has = append(has, bson.M{old: bson.M{"$exists": true}})
+	}
+	_, err := coll.UpdateMany(ctx, bson.M{"$or": has}, bson.M{"$rename": names})
+	return err
+}
+
+func createCollection(ctx context.Context, db *mongo.Database, name string) error {
+	err := db.CreateCollection(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists" {
+		return nil
+	}
+	return err
+}
+
+type Migrations struct {
+	Model
+	db       *mongo.Database
+	coll     *mongo.Collection
+	lockColl *mongo.Collection
+}
+
+func NewMigrations(cfg *config.Snapshot, lgr zerolog.Logger, client *mongo.Client) *Migrations {
+	lgr = lgr.With().Str("model", "migrations").Logger()
+	db := client.Database(cfg.Load().Mongo.DB)
+
+	return &Migrations{
+		Model: Model{
+			cfg:    cfg,
+			lgr:    lgr,
+			client: client,
+		},
+		db:       db,
+		coll:     db.Collection("schema_migrations"),
+		lockColl: db.Collection("schema_migrations_lock"),
+	}
+}
+
+func (m *Migrations) Steps() []migrate.Step {
+	steps := make([]migrate.Step, 0, len(migrations))
+	for _, mig := range migrations {
+		steps = append(steps, mig.Step)
+	}
+	return steps
+}
+
+// Lock holds a lease document. Taking it is an upsert that only matches an
+// expired lease, so while another process holds a live one the upsert fails
+// with a duplicate key. The lease is renewed until unlock, and the steps are
+// cancelled if that fails, see renew.
+func (m *Migrations) Lock(ctx context.Context) (context.Context, func(), error) {
+	owner := uuid.NewString()
+
+	var expires time.Time
+	for {
+		now := time.Now()
+		expires = now.Add(lockTTL)
+		_, err := m.lockColl.UpdateOne(ctx,
+			bson.M{"_id": "migrate", "expires_at": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": owner, "expires_at": expires}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			m.lgr.Error().Err(err).Msg("db query failed")
+			return nil, nil, translate(err)
+		}
+
+		m.lgr.Debug().Msg("waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return nil, nil, translate(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	locked, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		m.renew(locked, cancel, owner, expires)
+	}()
+
+	return locked, func() {
+		cancel()
+		<-renewed
+		_, err := m.lockColl.DeleteOne(context.Background(), bson.M{"_id": "migrate", "owner": owner})
+		if err != nil {
+			m.lgr.Error().Err(err).Msg("db query failed")
+		}
+	}, nil
+}
+
+// renew extends the lease of owner until ctx is done. It gives the lease up
+// and calls cancel when another process took it over, or when renewing keeps
+// failing until less than renewEvery is left, as the lease may then expire
+// before the next attempt.
+func (m *Migrations) renew(ctx context.Context, cancel context.CancelFunc, owner string, expires time.Time) {
+	ticker := time.NewTicker(renewEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		res, err := m.lockColl.UpdateOne(ctx,
+			bson.M{"_id": "migrate", "owner": owner},
+			bson.M{"$set": bson.M{"expires_at": now.Add(lockTTL)}},
+		)
+		switch {
+		case err == nil && res.MatchedCount == 1:
+			expires = now.Add(lockTTL)
+			m.lgr.Debug().Time("expires_at", expires).Msg("migration lock renewed")
+			continue
+		case err == nil:
+			m.lgr.Error().Msg("migration lock taken over")
+		case ctx.Err() != nil:
+			return
+		case time.Until(expires) > renewEvery:
+			m.lgr.Warn().Err(err).Time("expires_at", expires).Msg("migration lock renewal failed")
+			continue
+		default:
+			m.lgr.Error().Err(err).Time("expires_at", expires).Msg("migration lock renewal failed")
+		}
+
+		cancel()
+		return
+	}
+}
+
+func (m *Migrations) Applied(ctx context.Context) ([]uint, error) {
+	cursor, err := m.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "version", Value: 1}}))
+	if err != nil {
+		m.lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+	defer cursor.Close(ctx)
+
+	var versions []uint
+	for cursor.Next(ctx) {
+		var record struct {
+			Version uint `bson:"version"`
+		}
+		if err = cursor.Decode(&record); err != nil {
+			m.lgr.Error().Err(err).Msg("db scan failed")
+			return nil, translate(err)
+		}
+		versions = append(versions, record.Version)
+	}
+	if err = cursor.Err(); err != nil {
+		m.lgr.Error().Err(err).Msg("db scan failed")
+		return nil, translate(err)
+	}
+
+	return versions, nil
+}
+
+func (m *Migrations) Up(ctx context.Context, step migrate.Step) error {
+	lgr := m.lgr.With().
+		Str("api", "up").
+		Str("migration", step.String()).
+		Logger()
+
+	mig, err := m.find(step)
+	if err != nil {
+		return err
+	}
+	if err = mig.up(ctx, m.db); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	_, err = m.coll.InsertOne(ctx, bson.M{"version": step.Version, "name": step.Name, "applied_at": time.Now()})
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
+
+func (m *Migrations) Down(ctx context.Context, step migrate.Step) error {
+	lgr := m.lgr.With().
+		Str("api", "down").
+		Str("migration", step.String()).
+		Logger()
+
+	mig, err := m.find(step)
+	if err != nil {
+		return err
+	}
+	if err = mig.down(ctx, m.db); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	_, err = m.coll.DeleteOne(ctx, bson.M{"version": step.Version})
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
+
+func (m *Migrations) find(step migrate.Step) (migration, error) {
+	for _, mig := range migrations {
+		if mig.Version == step.Version {
+			return mig, nil
+		}
+	}
+	return migration{}, errors.New("unknown migration " + step.String())
+}
@@ -3,17 +3,27 @@ package mongo
 import (
 	"context"
 	"crud/internal/config"
+	"crud/internal/requestid"
+	"crud/internal/storage/errs"
+	"fmt"
 	"github.com/hendratommy/mongo-sequence/pkg/sequence"
 	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
-func NewClient(cfg *config.Config, lgr zerolog.Logger) (*mongo.Client, *mongo.Collection) {
+// NewClient connects to Mongo and returns the client, the collection of the
+// id sequences and the statistics of the connection pool.
+func NewClient(cfg *config.Snapshot, lgr zerolog.Logger) (*mongo.Client, *mongo.Collection, *Pool) {
 	lgr = lgr.With().Str("db", "mongo").Logger()
+	mgConf := cfg.Load().Mongo
 
-	client, err := mongo.NewClient(options.Client().ApplyURI(cfg.Mongo.URI))
+	opts := options.Client().ApplyURI(mgConf.URI)
+	pool := monitorPool(opts)
+
+	client, err := mongo.NewClient(opts)
 	if err != nil {
 		lgr.Fatal().Err(err).Msg("failed to create mongo client")
 	}
@@ -24,17 +34,66 @@ func NewClient(cfg *config.Config, lgr zerolog.Logger) (*mongo.Client, *mongo.Co
 		lgr.Fatal().Err(err).Msg("failed to ping mongo client")
 	}
 
-	seqColl := client.Database(cfg.Mongo.DB).Collection("sequences")
+	seqColl := client.Database(mgConf.DB).Collection("sequences")
 	sequence.SetupDefaultSequence(seqColl, 1*time.Second)
 
 	lgr.Debug().Msg("connection established")
 
-	return client, seqColl
+	return client, seqColl, pool
 }
 
 type Model struct {
-	cfg     *config.Config
+	cfg     *config.Snapshot
 	lgr     zerolog.Logger
 	client  *mongo.Client
 	seqColl *mongo.Collection
 }
+
+// transaction runs fn in a transaction, which the driver retries on
+// transient errors such as write conflicts. Transactions need a replica set
+// deployment.
+func (m *Model) transaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := m.client.StartSession()
+	if err != nil {
+		return translate(err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return translate(err)
+}
+
+// versioned selects a document by id and, unless version is zero, by the
+// version a conditional write expects.
+func versioned(id, version uint64) bson.M {
+	filter := bson.M{"id": id}
+	if version != 0 {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// unmatched tells a missing document from a stale version after a
+// conditional write on it has matched nothing.
+func unmatched(ctx context.Context, lgr zerolog.Logger, coll *mongo.Collection, entity string, id, version uint64) error {
+	n, err := coll.CountDocuments(ctx, bson.M{"id": id}, options.Count().SetComment(comment(ctx)))
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+	if n == 0 {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("%s %d not found", entity, id))
+	}
+
+	lgr.Debug().Msg("version mismatch")
+	return errs.StaleVersion(entity, id, version)
+}
+
+// comment names the request an operation runs for, as request_id=<id>, in
+// the profiler and the slow query log. Comments on writes need MongoDB 4.4.
+func comment(ctx context.Context) string {
+	return requestid.Comment(ctx)
+}
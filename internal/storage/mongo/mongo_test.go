@@ -0,0 +1,147 @@
+package mongo_test
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/storage"
+	"crud/internal/storage/migrate"
+	"crud/internal/storage/mongo"
+	"crud/internal/storage/storagetest"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"testing"
+	"time"
+)
+
+// The suite runs against CRUD_TEST_MONGO_DB (default "crud_test") and empties
+// the authors and posts collections between subtests. Author deletes and post
+// writes use transactions, so they need a replica set, such as the one
+// "make -C docker test" starts from docker/docker-compose.test.yml.
+const (
+	uriEnv = "CRUD_TEST_MONGO_URI"
+	dbEnv  = "CRUD_TEST_MONGO_DB"
+)
+
+func factory(t *testing.T, policy string) storagetest.Factory {
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s is not set, \"make -C docker test\" sets it", uriEnv)
+	}
+	db := os.Getenv(dbEnv)
+	if db == "" {
+		db = "crud_test"
+	}
+
+	cfg := config.NewSnapshot(&config.Config{
+		Database: config.DatabaseConfig{Name: "mongo", AuthorDeletePolicy: policy},
+		Mongo:    config.MongoConfig{URI: uri, DB: db},
+	})
+	lgr := zerolog.Nop()
+
+	client, seqColl, _ := mongo.NewClient(cfg, lgr)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	m := migrate.New(mongo.NewMigrations(cfg, lgr, client), lgr)
+	if _, err := m.Up(context.Background(), 0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	return func(t *testing.T) *storage.Storage {
+		for _, name := range []string{"authors", "posts"} {
+			_, err := client.Database(db).Collection(name).DeleteMany(context.Background(), bson.M{})
+			if err != nil {
+				t.Fatalf("empty %s: %v", name, err)
+			}
+		}
+
+		return &storage.Storage{
+			Authors: mongo.NewAuthors(cfg, lgr, client, seqColl),
+			Posts:   mongo.NewPosts(cfg, lgr, client),
+		}
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	storagetest.RunAuthors(t, factory(t, config.DeleteRestrict))
+}
+
+func TestPosts(t *testing.T) {
+	storagetest.RunPosts(t, factory(t, config.DeleteRestrict))
+}
+
+func TestDeletePolicy(t *testing.T) {
+	for _, policy := range []string{config.DeleteRestrict, config.DeleteCascade, config.DeleteOrphan} {
+		t.Run(policy, func(t *testing.T) {
+			storagetest.RunDeletePolicy(t, policy, factory(t, policy))
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s is not set, \"make -C docker test\" sets it", uriEnv)
+	}
+	db := os.Getenv(dbEnv)
+	if db == "" {
+		db = "crud_test"
+	}
+
+	cfg := config.NewSnapshot(&config.Config{Mongo: config.MongoConfig{URI: uri, DB: db}})
+	lgr := zerolog.Nop()
+
+	client, _, _ := mongo.NewClient(cfg, lgr)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	storagetest.RunMigrations(t, migrate.New(mongo.NewMigrations(cfg, lgr, client), lgr))
+}
+
+func TestLegacyPostFields(t *testing.T) {
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s is not set, \"make -C docker test\" sets it", uriEnv)
+	}
+	db := os.Getenv(dbEnv)
+	if db == "" {
+		db = "crud_test"
+	}
+
+	cfg := config.NewSnapshot(&config.Config{Mongo: config.MongoConfig{URI: uri, DB: db}})
+	lgr := zerolog.Nop()
+	ctx := context.Background()
+
+	client, _, _ := mongo.NewClient(cfg, lgr)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	m := migrate.New(mongo.NewMigrations(cfg, lgr, client), lgr)
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if _, err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+
+	posts := client.Database(db).Collection("posts")
+	if _, err := posts.DeleteMany(ctx, bson.M{}); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := posts.InsertOne(ctx, bson.M{
+		"id": 1, "authorid": 7, "title": "t", "content": "c", "createdat": created, "version": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Up(ctx, 0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	post, err := mongo.NewPosts(cfg, lgr, client).Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.AuthorId != 7 || !post.CreatedAt.Equal(created) {
+		t.Errorf("got %+v, want the legacy fields renamed", post)
+	}
+}
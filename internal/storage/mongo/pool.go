@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync/atomic"
+)
+
+// defaultMaxPoolSize is the driver's maxPoolSize when the URI sets none.
+const defaultMaxPoolSize = 100
+
+// Pool counts the connections of a client from its pool events, since the
+// driver does not expose them.
+type Pool struct {
+	max   uint64
+	open  atomic.Int64
+	inUse atomic.Int64
+}
+
+type PoolStat struct {
+	// Max is zero when the pool is unbounded.
+	Max   uint64
+	Open  int64
+	InUse int64
+}
+
+// monitorPool makes opts report to the returned Pool.
+func monitorPool(opts *options.ClientOptions) *Pool {
+	p := &Pool{max: defaultMaxPoolSize}
+	if opts.MaxPoolSize != nil {
+		p.max = *opts.MaxPoolSize
+	}
+
+	opts.SetPoolMonitor(&event.PoolMonitor{Event: p.event})
+
+	return p
+}
+
+func (p *Pool) event(e *event.PoolEvent) {
+	switch e.Type {
+	case event.ConnectionCreated:
+		p.open.Add(1)
+	case event.ConnectionClosed:
+		p.open.Add(-1)
+	case event.GetSucceeded:
+		p.inUse.Add(1)
+	case event.ConnectionReturned:
+		p.inUse.Add(-1)
+	}
+}
+
+func (p *Pool) Stat() PoolStat {
+	return PoolStat{
+		Max:   p.max,
+		Open:  p.open.Load(),
+		InUse: p.inUse.Load(),
+	}
+}
@@ -5,26 +5,36 @@ import (
 	"crud/internal/config"
 	"crud/internal/constants"
 	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/tracing"
+	"errors"
+	"fmt"
 	"github.com/hendratommy/mongo-sequence/pkg/sequence"
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
 type Posts struct {
 	Model
-	coll *mongo.Collection
+	coll        *mongo.Collection
+	authorsColl *mongo.Collection
 }
 
-func NewPosts(cfg *config.Config, lgr zerolog.Logger, client *mongo.Client) *Posts {
+func NewPosts(cfg *config.Snapshot, lgr zerolog.Logger, client *mongo.Client) *Posts {
 	return &Posts{
 		Model: Model{
 			cfg:    cfg,
 			lgr:    lgr,
 			client: client,
 		},
-		coll: client.Database(cfg.Mongo.DB).Collection("posts"),
+		coll:        client.Database(cfg.Load().Mongo.DB).Collection("posts"),
+		authorsColl: client.Database(cfg.Load().Mongo.DB).Collection("authors"),
 	}
 }
 
@@ -33,7 +43,8 @@ func (p *Posts) Add(ctx context.Context, post *entities.Post) error {
 	lgr := p.lgr.With().
 		Str("api", "Add").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("author_id", post.AuthorId).
 			Str("title", post.Title).
 			Str("content", post.Content).
@@ -46,13 +57,21 @@ func (p *Posts) Add(ctx context.Context, post *entities.Post) error {
 	seq, err := sequence.NextVal("posts_seq")
 	if err != nil {
 		lgr.Error().Err(err).Msg("db sequence failed")
-		return err
+		return translate(err)
 	}
+
 	post.Id = uint64(seq)
+	post.Version = 1
 
-	_, err = p.coll.InsertOne(ctx, post)
+	err = p.transaction(ctx, func(sc mongo.SessionContext) error {
+		if err := p.checkAuthor(sc, post.AuthorId); err != nil {
+			return err
+		}
+		_, err := p.coll.InsertOne(sc, post, options.InsertOne().SetComment(comment(sc)))
+		return err
+	})
 	if err != nil {
-		lgr.Error().Err(err).Msg("db query failed")
+		lgr.Error().Err(err).Msg("db transaction failed")
 		return err
 	}
 
@@ -61,36 +80,88 @@ func (p *Posts) Add(ctx context.Context, post *entities.Post) error {
 	return nil
 }
 
-func (p *Posts) List(ctx context.Context) ([]entities.Post, error) {
+func (p *Posts) List(ctx context.Context, opts query.Options) ([]entities.Post, string, error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := p.lgr.With().
 		Str("api", "List").
 		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
 		Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	cursor, err := p.coll.Find(ctx, bson.M{})
+	opts = opts.Normalize()
+
+	filter := filterPosts(opts.Filter)
+	if opts.After != nil {
+		var cursorValue interface{} = opts.After.Str
+		if opts.Sort == query.SortCreatedAt {
+			cursorValue = *opts.After.Time
+		}
+		filter = after(filter, opts, cursorValue)
+	}
+
+	cursor, err := p.coll.Find(ctx, filter, findOptions(opts).SetComment(comment(ctx)))
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return nil, err
+		return nil, "", translate(err)
 	}
+	defer cursor.Close(ctx)
 
-	posts := make([]entities.Post, 0, 10)
-	for cursor.Next(context.TODO()) {
+	posts := make([]entities.Post, 0, opts.Limit+1)
+	for cursor.Next(ctx) {
 		post := entities.Post{}
 		err = cursor.Decode(&post)
 		if err != nil {
 			lgr.Error().Err(err).Msg("db scan failed")
-			return nil, err
+			return nil, "", translate(err)
 		}
 		posts = append(posts, post)
 	}
+	if err = cursor.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db scan failed")
+		return nil, "", translate(err)
+	}
+
+	var next string
+	if len(posts) > opts.Limit {
+		posts = posts[:opts.Limit]
+		next = query.PostCursor(opts, posts[len(posts)-1]).Encode()
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return posts, next, nil
+}
+
+func (p *Posts) Get(ctx context.Context, id uint64) (*entities.Post, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Get").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	post := new(entities.Post)
+	err := p.coll.FindOne(ctx, bson.M{"id": id}, options.FindOne().SetComment(comment(ctx))).Decode(post)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("post %d not found", id))
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
 
 	lgr.Debug().Msg("executed")
 
-	return posts, nil
+	return post, nil
 }
 
 func (p *Posts) Update(ctx context.Context, post *entities.Post) (err error) {
@@ -98,55 +169,175 @@ func (p *Posts) Update(ctx context.Context, post *entities.Post) (err error) {
 	lgr := p.lgr.With().
 		Str("api", "Update").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("id", post.Id).
 			Uint64("author_id", post.AuthorId).
 			Str("title", post.Title).
 			Str("content", post.Content).
-			Time("created_at", post.CreatedAt),
+			Time("created_at", post.CreatedAt).
+			Uint64("version", post.Version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = p.coll.UpdateOne(ctx,
-		bson.M{"id": post.Id},
-		bson.M{"$set": bson.M{
-			"author_id": post.AuthorId,
-			"title":     post.Title,
-			"content":   post.Content},
-			"created_at": post.CreatedAt,
-		},
-	)
+	updated := entities.Post{}
+	err = p.transaction(ctx, func(sc mongo.SessionContext) error {
+		if err := p.checkAuthor(sc, post.AuthorId); err != nil {
+			return err
+		}
+		err := p.coll.FindOneAndUpdate(sc,
+			versioned(post.Id, post.Version),
+			bson.M{
+				"$set": bson.M{
+					"author_id":  post.AuthorId,
+					"title":      post.Title,
+					"content":    post.Content,
+					"created_at": post.CreatedAt,
+				},
+				"$inc": bson.M{"version": 1},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"version": 1}).SetComment(comment(sc)),
+		).Decode(&updated)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return unmatched(sc, lgr, p.coll, "post", post.Id, post.Version)
+		}
+		return err
+	})
+	if errors.Is(err, errs.ErrNotFound) || errors.Is(err, errs.ErrPrecondition) {
+		return err
+	}
 	if err != nil {
-		lgr.Error().Err(err).Msg("db query failed")
+		lgr.Error().Err(err).Msg("db transaction failed")
 		return err
 	}
+	post.Version = updated.Version
 
 	lgr.Debug().Msg("executed")
 
 	return nil
 }
 
-func (p *Posts) Delete(ctx context.Context, id uint64) (err error) {
+func (p *Posts) Patch(ctx context.Context, id, version uint64, patch *entities.PostPatch) (*entities.Post, error) {
+	if patch.Empty() {
+		post, err := p.Get(ctx, id)
+		if err == nil && version != 0 && version != post.Version {
+			return nil, errs.StaleVersion("post", id, version)
+		}
+		return post, err
+	}
+
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Patch").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version).
+			Strs("fields", patch.Fields()),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	set := bson.M{}
+	if patch.AuthorId != nil {
+		set["author_id"] = *patch.AuthorId
+	}
+	if patch.Title != nil {
+		set["title"] = *patch.Title
+	}
+	if patch.Content != nil {
+		set["content"] = *patch.Content
+	}
+	if patch.CreatedAt != nil {
+		set["created_at"] = *patch.CreatedAt
+	}
+
+	post := new(entities.Post)
+	update := func(ctx context.Context) error {
+		err := p.coll.FindOneAndUpdate(ctx,
+			versioned(id, version),
+			bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After).SetComment(comment(ctx)),
+		).Decode(post)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return unmatched(ctx, lgr, p.coll, "post", id, version)
+		}
+		return err
+	}
+
+	var err error
+	if patch.AuthorId == nil {
+		err = translate(update(ctx))
+	} else {
+		err = p.transaction(ctx, func(sc mongo.SessionContext) error {
+			if err := p.checkAuthor(sc, *patch.AuthorId); err != nil {
+				return err
+			}
+			return update(sc)
+		})
+	}
+	if errors.Is(err, errs.ErrNotFound) || errors.Is(err, errs.ErrPrecondition) {
+		return nil, err
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, err
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return post, nil
+}
+
+func (p *Posts) Delete(ctx context.Context, id, version uint64) (err error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := p.lgr.With().
 		Str("api", "Delete").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
-			Uint64("id", id),
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = p.coll.DeleteOne(ctx, bson.M{"id": id})
+	res, err := p.coll.DeleteOne(ctx, versioned(id, version), options.Delete().SetComment(comment(ctx)))
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
+	}
+	if res.DeletedCount == 0 {
+		return unmatched(ctx, lgr, p.coll, "post", id, version)
 	}
 
 	lgr.Debug().Msg("executed")
 
 	return nil
 }
+
+// checkAuthor emulates posts_author_id_fk from the Postgres schema, which
+// Mongo has no equivalent for. It must run in the transaction that writes the
+// post: the check writes to the author, so that deleting them concurrently
+// conflicts with it instead of both transactions committing on their
+// snapshots. The driver then retries the loser, which sees the winner's
+// write.
+func (p *Posts) checkAuthor(sc mongo.SessionContext, authorId uint64) error {
+	res, err := p.authorsColl.UpdateOne(sc,
+		bson.M{"id": authorId},
+		bson.M{"$set": bson.M{"fk_lock": primitive.NewObjectID()}},
+		options.Update().SetComment(comment(sc)),
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errs.MissingAuthor(authorId)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package mongo
+
+import (
+	"crud/internal/storage/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+)
+
+func filterPosts(f query.Filter) bson.M {
+	filter := bson.M{}
+	if f.AuthorId != 0 {
+		filter["author_id"] = f.AuthorId
+	}
+
+	createdAt := bson.M{}
+	if !f.CreatedFrom.IsZero() {
+		createdAt["$gte"] = f.CreatedFrom
+	}
+	if !f.CreatedTo.IsZero() {
+		createdAt["$lt"] = f.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	if f.TitlePrefix != "" {
+		filter["title"] = bson.M{"$regex": "^" + regexp.QuoteMeta(f.TitlePrefix)}
+	}
+
+	return filter
+}
+
+// after adds the keyset condition skipping the rows up to and including the
+// one the cursor points at. cursorValue is ignored when sorting by id.
+func after(filter bson.M, opts query.Options, cursorValue interface{}) bson.M {
+	if opts.After == nil {
+		return filter
+	}
+
+	op := "$gt"
+	if opts.Order == query.Desc {
+		op = "$lt"
+	}
+
+	var keyset bson.M
+	if opts.Sort == query.SortId {
+		keyset = bson.M{"id": bson.M{op: opts.After.Id}}
+	} else {
+		keyset = bson.M{"$or": bson.A{
+			bson.M{opts.Sort: bson.M{op: cursorValue}},
+			bson.M{opts.Sort: cursorValue, "id": bson.M{op: opts.After.Id}},
+		}}
+	}
+
+	if len(filter) == 0 {
+		return keyset
+	}
+	return bson.M{"$and": bson.A{filter, keyset}}
+}
+
+// findOptions sorts by the requested field and then by id, and fetches one
+// extra document to find out whether there is a next page.
+func findOptions(opts query.Options) *options.FindOptions {
+	dir := 1
+	if opts.Order == query.Desc {
+		dir = -1
+	}
+
+	sort := bson.D{}
+	if opts.Sort != query.SortId {
+		sort = append(sort, bson.E{Key: opts.Sort, Value: dir})
+	}
+	sort = append(sort, bson.E{Key: "id", Value: dir})
+
+	return options.Find().SetSort(sort).SetLimit(int64(opts.Limit + 1))
+}
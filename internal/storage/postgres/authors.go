@@ -5,8 +5,16 @@ import (
 	"crud/internal/config"
 	"crud/internal/constants"
 	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/tracing"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/rs/zerolog"
+	"strings"
 	"time"
 )
 
@@ -14,7 +22,7 @@ type Authors struct {
 	Model
 }
 
-func NewAuthors(cfg *config.Config, lgr zerolog.Logger, conn *pgxpool.Pool) *Authors {
+func NewAuthors(cfg *config.Snapshot, lgr zerolog.Logger, conn *pgxpool.Pool) *Authors {
 	lgr = lgr.With().Str("model", "authors").Logger()
 
 	return &Authors{
@@ -31,19 +39,21 @@ func (a *Authors) Add(ctx context.Context, author *entities.Author) (err error)
 	lgr := a.lgr.With().
 		Str("api", "Add").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Str("name", author.Name),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = a.Model.conn.Exec(ctx,
+	err = a.Model.db().QueryRow(ctx,
 		`INSERT INTO public.authors(name) 
-			 VALUES ($1)`, author.Name)
+			 VALUES ($1)
+			 RETURNING id, version`, author.Name).Scan(&(author.Id), &(author.Version))
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
 	}
 
 	lgr.Debug().Msg("executed")
@@ -51,38 +61,89 @@ func (a *Authors) Add(ctx context.Context, author *entities.Author) (err error)
 	return nil
 }
 
-func (a *Authors) List(ctx context.Context) ([]entities.Author, error) {
+func (a *Authors) List(ctx context.Context, opts query.Options) ([]entities.Author, string, error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := a.lgr.With().
 		Str("api", "List").
 		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
 		Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := a.Model.conn.Query(ctx,
-		`SELECT id, name
-			 FROM public.authors`)
+	opts = opts.Normalize()
+
+	q := new(sqlBuilder)
+	if opts.After != nil {
+		q.after(opts, opts.After.Str)
+	}
+
+	rows, err := a.Model.db().Query(ctx,
+		`SELECT id, name, version
+			 FROM public.authors`+q.tail(opts), q.args...)
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return nil, err
+		return nil, "", translate(err)
 	}
+	defer rows.Close()
 
-	authors := make([]entities.Author, 0, 10)
+	authors := make([]entities.Author, 0, opts.Limit+1)
 	for rows.Next() {
 		author := entities.Author{}
-		err = rows.Scan(&(author.Id), &(author.Name))
+		err = rows.Scan(&(author.Id), &(author.Name), &(author.Version))
 		if err != nil {
 			lgr.Error().Err(err).Msg("db scan failed")
-			return nil, err
+			return nil, "", translate(err)
 		}
 		authors = append(authors, author)
 	}
+	if err = rows.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db scan failed")
+		return nil, "", translate(err)
+	}
+
+	var next string
+	if len(authors) > opts.Limit {
+		authors = authors[:opts.Limit]
+		next = query.AuthorCursor(opts, authors[len(authors)-1]).Encode()
+	}
 
 	lgr.Debug().Msg("executed")
 
-	return authors, nil
+	return authors, next, nil
+}
+
+func (a *Authors) Get(ctx context.Context, id uint64) (*entities.Author, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Get").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	author := new(entities.Author)
+	err := a.Model.db().QueryRow(ctx,
+		`SELECT id, name, version
+			 FROM public.authors
+			 WHERE id = $1`, id).Scan(&(author.Id), &(author.Name), &(author.Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", id))
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return author, nil
 }
 
 func (a *Authors) Update(ctx context.Context, author *entities.Author) (err error) {
@@ -90,21 +151,28 @@ func (a *Authors) Update(ctx context.Context, author *entities.Author) (err erro
 	lgr := a.lgr.With().
 		Str("api", "Update").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("id", author.Id).
-			Str("name", author.Name),
+			Str("name", author.Name).
+			Uint64("version", author.Version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = a.Model.conn.Exec(ctx,
+	q := &sqlBuilder{args: []interface{}{author.Id, author.Name}}
+	err = a.Model.db().QueryRow(ctx,
 		`UPDATE public.authors
-			 SET name = $2
-			 WHERE id = $1`, author.Id, author.Name)
+			 SET name = $2, version = version + 1
+			 WHERE id = $1`+q.version(author.Version)+`
+			 RETURNING version`, q.args...).Scan(&(author.Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a.unmatched(ctx, lgr, "authors", "author", author.Id, author.Version)
+	}
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
 	}
 
 	lgr.Debug().Msg("executed")
@@ -112,24 +180,125 @@ func (a *Authors) Update(ctx context.Context, author *entities.Author) (err erro
 	return nil
 }
 
-func (a *Authors) Delete(ctx context.Context, id uint64) (err error) {
+func (a *Authors) Patch(ctx context.Context, id, version uint64, patch *entities.AuthorPatch) (*entities.Author, error) {
+	if patch.Empty() {
+		author, err := a.Get(ctx, id)
+		if err == nil && version != 0 && version != author.Version {
+			return nil, errs.StaleVersion("author", id, version)
+		}
+		return author, err
+	}
+
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := a.lgr.With().
+		Str("api", "Patch").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version).
+			Strs("fields", patch.Fields()),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	q := &sqlBuilder{args: []interface{}{id}}
+	set := make([]string, 0, 2)
+	if patch.Name != nil {
+		set = append(set, "name = "+q.arg(*patch.Name))
+	}
+	set = append(set, "version = version + 1")
+
+	author := new(entities.Author)
+	err := a.Model.db().QueryRow(ctx,
+		`UPDATE public.authors
+			 SET `+strings.Join(set, ", ")+`
+			 WHERE id = $1`+q.version(version)+`
+			 RETURNING id, name, version`, q.args...).Scan(&(author.Id), &(author.Name), &(author.Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, a.unmatched(ctx, lgr, "authors", "author", id, version)
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return author, nil
+}
+
+func (a *Authors) Delete(ctx context.Context, id, version uint64) (err error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := a.lgr.With().
 		Str("api", "Delete").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
-			Uint64("id", id),
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = a.Model.conn.Exec(ctx,
+	tx, err := a.Model.conn.Begin(ctx)
+	if err != nil {
+		lgr.Error().Err(err).Msg("db begin failed")
+		return translate(err)
+	}
+	defer tx.Rollback(ctx)
+	db := a.commented(tx)
+
+	// Locking the author blocks concurrent inserts of its posts until the
+	// policy has been applied.
+	var current uint64
+	err = db.QueryRow(ctx,
+		`SELECT version
+			 FROM public.authors
+			 WHERE id = $1
+			 FOR UPDATE`, id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("author %d not found", id))
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+	if version != 0 && version != current {
+		lgr.Debug().Uint64("current_version", current).Msg("version mismatch")
+		return errs.StaleVersion("author", id, version)
+	}
+
+	switch a.cfg.Load().Database.AuthorDeletePolicy {
+	case config.DeleteCascade:
+		_, err = db.Exec(ctx,
+			`DELETE FROM public.posts
+				 WHERE author_id = $1`, id)
+	case config.DeleteOrphan:
+		_, err = db.Exec(ctx,
+			`UPDATE public.posts
+				 SET author_id = NULL, version = version + 1
+				 WHERE author_id = $1`, id)
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	_, err = db.Exec(ctx,
 		`DELETE FROM public.authors
 			 WHERE id = $1`, id)
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		lgr.Error().Err(err).Msg("db commit failed")
+		return translate(err)
 	}
 
 	lgr.Debug().Msg("executed")
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"crud/internal/requestid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// commented runs statements of a request prefixed with
+// /* request_id=... */ when postgres.comment_queries is set, so that slow
+// query logs and pg_stat_activity can be joined with the request logs.
+//
+// The comment makes every statement text unique, so commented statements
+// use the simple protocol instead of filling the prepared statement cache
+// with statements that never run twice. Arguments are then interpolated by
+// the driver and results come back as text, which is why it is opt-in.
+type commented struct {
+	q  querier
+	on bool
+}
+
+func (c commented) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	sql, args = c.comment(ctx, sql, args)
+	return c.q.Exec(ctx, sql, args...)
+}
+
+func (c commented) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	sql, args = c.comment(ctx, sql, args)
+	return c.q.Query(ctx, sql, args...)
+}
+
+func (c commented) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	sql, args = c.comment(ctx, sql, args)
+	return c.q.QueryRow(ctx, sql, args...)
+}
+
+func (c commented) comment(ctx context.Context, sql string, args []interface{}) (string, []interface{}) {
+	if !c.on {
+		return sql, args
+	}
+	comment := requestid.Comment(ctx)
+	if comment == "" {
+		return sql, args
+	}
+	return "/* " + comment + " */ " + sql, append([]interface{}{pgx.QuerySimpleProtocol(true)}, args...)
+}
+
+// db runs statements on the pool, see commented.
+func (m *Model) db() commented {
+	return m.commented(m.conn)
+}
+
+// commented runs statements on q, see commented.
+func (m *Model) commented(q querier) commented {
+	return commented{q: q, on: m.cfg.Load().Postgres.CommentQueries}
+}
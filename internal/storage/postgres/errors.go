@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	"crud/internal/storage/errs"
+	"errors"
+	"github.com/jackc/pgconn"
+	"net"
+	"strings"
+)
+
+// translate maps driver errors onto the storage error kinds. SQLSTATE codes
+// are listed in https://www.postgresql.org/docs/current/errcodes-appendix.html.
+func translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23503":
+			return errs.Wrap(errs.ErrForeignKey,
+				"violates foreign key constraint "+pgErr.ConstraintName+": "+pgErr.Detail, err)
+		case pgErr.Code == "23505":
+			return errs.Wrap(errs.ErrConflict, "violates unique constraint "+pgErr.ConstraintName, err)
+		case pgErr.Code == "40001", pgErr.Code == "40P01":
+			return errs.Wrap(errs.ErrConflict, "concurrent update, retry the request", err)
+		case strings.HasPrefix(pgErr.Code, "22"), pgErr.Code == "23502", pgErr.Code == "23514":
+			return errs.Wrap(errs.ErrInvalid, "invalid value", err)
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"),
+			strings.HasPrefix(pgErr.Code, "57P"):
+			return errs.Wrap(errs.ErrUnavailable, "database unavailable", err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) ||
+		pgconn.SafeToRetry(err) {
+		return errs.Wrap(errs.ErrUnavailable, "database unavailable", err)
+	}
+
+	return err
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/storage/migrate"
+	"embed"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are pairs of NNNN_name.up.sql and NNNN_name.down.sql files. Each
+// one runs in a transaction together with its schema_migrations record.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the advisory lock held while migrating.
+const migrationLockKey = 0x63727564 // "crud"
+
+type Migrations struct {
+	Model
+	steps []migrate.Step
+}
+
+func NewMigrations(cfg *config.Snapshot, lgr zerolog.Logger, conn *pgxpool.Pool) *Migrations {
+	lgr = lgr.With().Str("model", "migrations").Logger()
+
+	return &Migrations{
+		Model: Model{
+			cfg:  cfg,
+			lgr:  lgr,
+			conn: conn,
+		},
+		steps: migrationSteps(),
+	}
+}
+
+func migrationSteps() []migrate.Step {
+	names, err := fs.Glob(migrationFiles, "migrations/*.up.sql")
+	if err != nil {
+		panic(err)
+	}
+
+	steps := make([]migrate.Step, 0, len(names))
+	for _, name := range names {
+		base := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".up.sql")
+		i := strings.IndexByte(base, '_')
+		if i < 0 {
+			panic(fmt.Sprintf("postgres: incorrect migration name %s", name))
+		}
+		version, err := strconv.ParseUint(base[:i], 10, 32)
+		if err != nil {
+			panic(fmt.Sprintf("postgres: incorrect migration name %s", name))
+		}
+		steps = append(steps, migrate.Step{Version: uint(version), Name: base[i+1:]})
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Version < steps[j].Version })
+
+	return steps
+}
+
+func (m *Migrations) Steps() []migrate.Step {
+	return m.steps
+}
+
+// Lock takes a session-level advisory lock on a dedicated connection, so it
+// is released even if the process dies mid-way. It is only lost together
+// with the connection, so the steps run with ctx.
+func (m *Migrations) Lock(ctx context.Context) (context.Context, func(), error) {
+	conn, err := m.conn.Acquire(ctx)
+	if err != nil {
+		m.lgr.Error().Err(err).Msg("db acquire failed")
+		return nil, nil, translate(err)
+	}
+
+	m.lgr.Debug().Msg("waiting for the migration lock")
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		conn.Release()
+		m.lgr.Error().Err(err).Msg("db query failed")
+		return nil, nil, translate(err)
+	}
+
+	_, err = conn.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS public.schema_migrations
+			 (
+				 version    bigint                    not null,
+				 name       varchar                   not null,
+				 applied_at timestamptz default now() not null,
+				 constraint schema_migrations_pk
+					 primary key (version)
+			 )`)
+	if err != nil {
+		m.unlock(conn)
+		m.lgr.Error().Err(err).Msg("db query failed")
+		return nil, nil, translate(err)
+	}
+
+	return ctx, func() { m.unlock(conn) }, nil
+}
+
+func (m *Migrations) unlock(conn *pgxpool.Conn) {
+	_, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	if err != nil {
+		m.lgr.Error().Err(err).Msg("db query failed")
+		// The lock belongs to the session, closing it is the only way left.
+		conn.Conn().Close(context.Background())
+	}
+	conn.Release()
+}
+
+func (m *Migrations) Applied(ctx context.Context) ([]uint, error) {
+	var exists bool
+	err := m.conn.QueryRow(ctx,
+		`SELECT to_regclass('public.schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		m.lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := m.conn.Query(ctx,
+		`SELECT version
+			 FROM public.schema_migrations
+			 ORDER BY version`)
+	if err != nil {
+		m.lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+	defer rows.Close()
+
+	var versions []uint
+	for rows.Next() {
+		var version uint64
+		if err = rows.Scan(&version); err != nil {
+			m.lgr.Error().Err(err).Msg("db scan failed")
+			return nil, translate(err)
+		}
+		versions = append(versions, uint(version))
+	}
+	if err = rows.Err(); err != nil {
+		m.lgr.Error().Err(err).Msg("db scan failed")
+		return nil, translate(err)
+	}
+
+	return versions, nil
+}
+
+func (m *Migrations) Up(ctx context.Context, step migrate.Step) error {
+	return m.run(ctx, step, "up", func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO public.schema_migrations(version, name)
+				 VALUES ($1, $2)`, uint64(step.Version), step.Name)
+		return err
+	})
+}
+
+func (m *Migrations) Down(ctx context.Context, step migrate.Step) error {
+	return m.run(ctx, step, "down", func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`DELETE FROM public.schema_migrations
+				 WHERE version = $1`, uint64(step.Version))
+		return err
+	})
+}
+
+// run executes one direction of a step and updates schema_migrations in the
+// same transaction.
+func (m *Migrations) run(ctx context.Context, step migrate.Step, direction string, record func(pgx.Tx) error) error {
+	lgr := m.lgr.With().
+		Str("api", direction).
+		Str("migration", step.String()).
+		Logger()
+
+	script, err := migrationFiles.ReadFile("migrations/" + step.String() + "." + direction + ".sql")
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		lgr.Error().Err(err).Msg("db begin failed")
+		return translate(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Without arguments the script goes through the simple protocol, which
+	// accepts several statements.
+	if _, err = tx.Exec(ctx, string(script)); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+	if err = record(tx); err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		lgr.Error().Err(err).Msg("db commit failed")
+		return translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return nil
+}
@@ -0,0 +1,5 @@
+drop table public.posts;
+drop sequence public.posts_id_seq;
+
+drop table public.authors;
+drop sequence public.authors_id_seq;
@@ -1,4 +1,6 @@
-create sequence public.authors_id_seq;
+-- "if not exists" lets the first run adopt a database set up by the old
+-- docker init scripts.
+create sequence if not exists public.authors_id_seq;
 create table if not exists public.authors
 (
     id   bigint default nextval('public.authors_id_seq') not null,
@@ -7,8 +9,7 @@ create table if not exists public.authors
         primary key (id)
 );
 
-
-create sequence public.posts_id_seq;
+create sequence if not exists public.posts_id_seq;
 create table if not exists public.posts
 (
     id         bigint default nextval('public.posts_id_seq') not null,
@@ -20,4 +21,4 @@ create table if not exists public.posts
         primary key (id),
     constraint posts_author_id_fk
         foreign key (author_id) references public.authors
-);
\ No newline at end of file
+);
@@ -0,0 +1,3 @@
+-- fails while orphaned posts exist, they have to be removed or reassigned first
+alter table public.posts
+    alter column author_id set not null;
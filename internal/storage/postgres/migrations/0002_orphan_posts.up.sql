@@ -0,0 +1,3 @@
+-- posts of an author deleted with the "orphan" policy keep living without one
+alter table public.posts
+    alter column author_id drop not null;
@@ -0,0 +1,5 @@
+alter table public.authors
+    drop column version;
+
+alter table public.posts
+    drop column version;
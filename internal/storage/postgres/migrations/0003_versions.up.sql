@@ -0,0 +1,6 @@
+-- row versions for optimistic concurrency, incremented by every write
+alter table public.authors
+    add column if not exists version bigint default 1 not null;
+
+alter table public.posts
+    add column if not exists version bigint default 1 not null;
@@ -3,14 +3,18 @@ package postgres
 import (
 	"context"
 	"crud/internal/config"
+	"crud/internal/storage/errs"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/rs/zerolog"
 )
 
-func NewConn(cfg *config.Config, lgr zerolog.Logger) *pgxpool.Pool {
+func NewConn(cfg *config.Snapshot, lgr zerolog.Logger) *pgxpool.Pool {
 	lgr = lgr.With().Str("db", "postgres").Logger()
 
-	pgConf, err := pgxpool.ParseConfig(cfg.Postgres.URI)
+	pgConf, err := pgxpool.ParseConfig(cfg.Load().Postgres.URI)
 	if err != nil {
 		lgr.Fatal().Err(err).Msg("failed parse PostgreSQL config")
 	}
@@ -31,7 +35,28 @@ func NewConn(cfg *config.Config, lgr zerolog.Logger) *pgxpool.Pool {
 }
 
 type Model struct {
-	cfg  *config.Config
+	cfg  *config.Snapshot
 	lgr  zerolog.Logger
 	conn *pgxpool.Pool
 }
+
+// unmatched tells a missing row from a stale version after a conditional
+// statement on it has matched nothing.
+func (m *Model) unmatched(ctx context.Context, lgr zerolog.Logger, table, entity string, id, version uint64) error {
+	var current uint64
+	err := m.db().QueryRow(ctx,
+		`SELECT version
+			 FROM public.`+table+`
+			 WHERE id = $1`, id).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		lgr.Debug().Msg("not found")
+		return errs.New(errs.ErrNotFound, fmt.Sprintf("%s %d not found", entity, id))
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return translate(err)
+	}
+
+	lgr.Debug().Uint64("current_version", current).Msg("version mismatch")
+	return errs.StaleVersion(entity, id, version)
+}
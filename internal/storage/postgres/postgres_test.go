@@ -0,0 +1,82 @@
+package postgres_test
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/storage"
+	"crud/internal/storage/migrate"
+	"crud/internal/storage/postgres"
+	"crud/internal/storage/storagetest"
+	"github.com/rs/zerolog"
+	"os"
+	"testing"
+)
+
+// The suite migrates the database up, e.g. the throwaway one that
+// "make -C docker test" starts from docker/docker-compose.test.yml. All rows
+// are removed between subtests.
+const uriEnv = "CRUD_TEST_POSTGRES_URI"
+
+func factory(t *testing.T, policy string) storagetest.Factory {
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s is not set, \"make -C docker test\" sets it", uriEnv)
+	}
+
+	cfg := config.NewSnapshot(&config.Config{
+		Database: config.DatabaseConfig{Name: "postgres", AuthorDeletePolicy: policy},
+		Postgres: config.PostgresConfig{URI: uri},
+	})
+	lgr := zerolog.Nop()
+
+	conn := postgres.NewConn(cfg, lgr)
+	t.Cleanup(conn.Close)
+
+	m := migrate.New(postgres.NewMigrations(cfg, lgr, conn), lgr)
+	if _, err := m.Up(context.Background(), 0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	return func(t *testing.T) *storage.Storage {
+		_, err := conn.Exec(context.Background(), `TRUNCATE public.posts, public.authors`)
+		if err != nil {
+			t.Fatalf("truncate tables: %v", err)
+		}
+
+		return &storage.Storage{
+			Authors: postgres.NewAuthors(cfg, lgr, conn),
+			Posts:   postgres.NewPosts(cfg, lgr, conn),
+		}
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	storagetest.RunAuthors(t, factory(t, config.DeleteRestrict))
+}
+
+func TestPosts(t *testing.T) {
+	storagetest.RunPosts(t, factory(t, config.DeleteRestrict))
+}
+
+func TestDeletePolicy(t *testing.T) {
+	for _, policy := range []string{config.DeleteRestrict, config.DeleteCascade, config.DeleteOrphan} {
+		t.Run(policy, func(t *testing.T) {
+			storagetest.RunDeletePolicy(t, policy, factory(t, policy))
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	uri := os.Getenv(uriEnv)
+	if uri == "" {
+		t.Skipf("%s is not set, \"make -C docker test\" sets it", uriEnv)
+	}
+
+	cfg := config.NewSnapshot(&config.Config{Postgres: config.PostgresConfig{URI: uri}})
+	lgr := zerolog.Nop()
+
+	conn := postgres.NewConn(cfg, lgr)
+	t.Cleanup(conn.Close)
+
+	storagetest.RunMigrations(t, migrate.New(postgres.NewMigrations(cfg, lgr, conn), lgr))
+}
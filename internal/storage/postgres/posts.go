@@ -5,8 +5,16 @@ import (
 	"crud/internal/config"
 	"crud/internal/constants"
 	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/query"
+	"crud/pkg/logger"
+	"crud/pkg/tracing"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/rs/zerolog"
+	"strings"
 	"time"
 )
 
@@ -14,7 +22,7 @@ type Posts struct {
 	Model
 }
 
-func NewPosts(cfg *config.Config, lgr zerolog.Logger, conn *pgxpool.Pool) *Posts {
+func NewPosts(cfg *config.Snapshot, lgr zerolog.Logger, conn *pgxpool.Pool) *Posts {
 	lgr = lgr.With().Str("model", "posts").Logger()
 
 	return &Posts{
@@ -31,7 +39,8 @@ func (p *Posts) Add(ctx context.Context, post *entities.Post) (err error) {
 	lgr := p.lgr.With().
 		Str("api", "Add").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("author_id", post.AuthorId).
 			Str("title", post.Title).
 			Str("content", post.Content).
@@ -41,12 +50,14 @@ func (p *Posts) Add(ctx context.Context, post *entities.Post) (err error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = p.Model.conn.Exec(ctx,
+	err = p.Model.db().QueryRow(ctx,
 		`INSERT INTO public.posts(author_id, title, content, created_at) 
-			 VALUES ($1, $2, $3, $4)`, post.AuthorId, post.Title, post.Content, post.CreatedAt)
+			 VALUES ($1, $2, $3, $4)
+			 RETURNING id, version`, post.AuthorId, post.Title, post.Content, post.CreatedAt).
+		Scan(&(post.Id), &(post.Version))
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
 	}
 
 	lgr.Debug().Msg("executed")
@@ -54,38 +65,96 @@ func (p *Posts) Add(ctx context.Context, post *entities.Post) (err error) {
 	return nil
 }
 
-func (p *Posts) List(ctx context.Context) ([]entities.Post, error) {
+func (p *Posts) List(ctx context.Context, opts query.Options) ([]entities.Post, string, error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := p.lgr.With().
 		Str("api", "List").
 		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
 		Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	rows, err := p.Model.conn.Query(ctx,
-		`SELECT id, author_id, title, content, created_at
-			 FROM public.posts`)
+	opts = opts.Normalize()
+
+	q := new(sqlBuilder)
+	q.filterPosts(opts.Filter)
+	if opts.After != nil {
+		var cursorValue interface{} = opts.After.Str
+		if opts.Sort == query.SortCreatedAt {
+			cursorValue = *opts.After.Time
+		}
+		q.after(opts, cursorValue)
+	}
+
+	rows, err := p.Model.db().Query(ctx,
+		`SELECT id, COALESCE(author_id, 0), title, content, created_at, version
+			 FROM public.posts`+q.tail(opts), q.args...)
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return nil, err
+		return nil, "", translate(err)
 	}
+	defer rows.Close()
 
-	posts := make([]entities.Post, 0, 10)
+	posts := make([]entities.Post, 0, opts.Limit+1)
 	for rows.Next() {
 		post := entities.Post{}
-		err = rows.Scan(&(post.Id), &(post.AuthorId), &(post.Title), &(post.Content), &(post.CreatedAt))
+		err = rows.Scan(&(post.Id), &(post.AuthorId), &(post.Title), &(post.Content), &(post.CreatedAt),
+			&(post.Version))
 		if err != nil {
 			lgr.Error().Err(err).Msg("db scan failed")
-			return nil, err
+			return nil, "", translate(err)
 		}
 		posts = append(posts, post)
 	}
+	if err = rows.Err(); err != nil {
+		lgr.Error().Err(err).Msg("db scan failed")
+		return nil, "", translate(err)
+	}
+
+	var next string
+	if len(posts) > opts.Limit {
+		posts = posts[:opts.Limit]
+		next = query.PostCursor(opts, posts[len(posts)-1]).Encode()
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return posts, next, nil
+}
+
+func (p *Posts) Get(ctx context.Context, id uint64) (*entities.Post, error) {
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Get").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	post := new(entities.Post)
+	err := p.Model.db().QueryRow(ctx,
+		`SELECT id, COALESCE(author_id, 0), title, content, created_at, version
+			 FROM public.posts
+			 WHERE id = $1`, id).
+		Scan(&(post.Id), &(post.AuthorId), &(post.Title), &(post.Content), &(post.CreatedAt), &(post.Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		lgr.Debug().Msg("not found")
+		return nil, errs.New(errs.ErrNotFound, fmt.Sprintf("post %d not found", id))
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
 
 	lgr.Debug().Msg("executed")
 
-	return posts, nil
+	return post, nil
 }
 
 func (p *Posts) Update(ctx context.Context, post *entities.Post) (err error) {
@@ -93,24 +162,31 @@ func (p *Posts) Update(ctx context.Context, post *entities.Post) (err error) {
 	lgr := p.lgr.With().
 		Str("api", "Update").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
 			Uint64("id", post.Id).
 			Uint64("author_id", post.AuthorId).
 			Str("title", post.Title).
 			Str("content", post.Content).
-			Time("created_at", post.CreatedAt),
+			Time("created_at", post.CreatedAt).
+			Uint64("version", post.Version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = p.Model.conn.Exec(ctx,
+	q := &sqlBuilder{args: []interface{}{post.Id, post.AuthorId, post.Title, post.Content, post.CreatedAt}}
+	err = p.Model.db().QueryRow(ctx,
 		`UPDATE public.posts
-			 SET author_id = $2, title = $3, content = $4, created_at = $5
-			 WHERE id = $1`, post.Id, post.AuthorId, post.Title, post.Content, post.CreatedAt)
+			 SET author_id = $2, title = $3, content = $4, created_at = $5, version = version + 1
+			 WHERE id = $1`+q.version(post.Version)+`
+			 RETURNING version`, q.args...).Scan(&(post.Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p.unmatched(ctx, lgr, "posts", "post", post.Id, post.Version)
+	}
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
 	}
 
 	lgr.Debug().Msg("executed")
@@ -118,24 +194,89 @@ func (p *Posts) Update(ctx context.Context, post *entities.Post) (err error) {
 	return nil
 }
 
-func (p *Posts) Delete(ctx context.Context, id uint64) (err error) {
+func (p *Posts) Patch(ctx context.Context, id, version uint64, patch *entities.PostPatch) (*entities.Post, error) {
+	if patch.Empty() {
+		post, err := p.Get(ctx, id)
+		if err == nil && version != 0 && version != post.Version {
+			return nil, errs.StaleVersion("post", id, version)
+		}
+		return post, err
+	}
+
+	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
+	lgr := p.lgr.With().
+		Str("api", "Patch").
+		Str(constants.RequestIdKey, requestId).
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version).
+			Strs("fields", patch.Fields()),
+		).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	q := &sqlBuilder{args: []interface{}{id}}
+	set := make([]string, 0, 5)
+	if patch.AuthorId != nil {
+		set = append(set, "author_id = "+q.arg(*patch.AuthorId))
+	}
+	if patch.Title != nil {
+		set = append(set, "title = "+q.arg(*patch.Title))
+	}
+	if patch.Content != nil {
+		set = append(set, "content = "+q.arg(*patch.Content))
+	}
+	if patch.CreatedAt != nil {
+		set = append(set, "created_at = "+q.arg(*patch.CreatedAt))
+	}
+	set = append(set, "version = version + 1")
+
+	post := new(entities.Post)
+	err := p.Model.db().QueryRow(ctx,
+		`UPDATE public.posts
+			 SET `+strings.Join(set, ", ")+`
+			 WHERE id = $1`+q.version(version)+`
+			 RETURNING id, COALESCE(author_id, 0), title, content, created_at, version`, q.args...).
+		Scan(&(post.Id), &(post.AuthorId), &(post.Title), &(post.Content), &(post.CreatedAt), &(post.Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, p.unmatched(ctx, lgr, "posts", "post", id, version)
+	}
+	if err != nil {
+		lgr.Error().Err(err).Msg("db query failed")
+		return nil, translate(err)
+	}
+
+	lgr.Debug().Msg("executed")
+
+	return post, nil
+}
+
+func (p *Posts) Delete(ctx context.Context, id, version uint64) (err error) {
 	requestId, _ := ctx.Value(constants.RequestIdKey).(string)
 	lgr := p.lgr.With().
 		Str("api", "Delete").
 		Str(constants.RequestIdKey, requestId).
-		Dict("request", zerolog.Dict().
-			Uint64("id", id),
+		EmbedObject(tracing.FromContext(ctx)).
+		Object("request", logger.Dict().
+			Uint64("id", id).
+			Uint64("version", version),
 		).Logger()
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	_, err = p.Model.conn.Exec(ctx,
-		`DELETE public.authors
-			 WHERE id = $1`, id)
+	q := &sqlBuilder{args: []interface{}{id}}
+	tag, err := p.Model.db().Exec(ctx,
+		`DELETE FROM public.posts
+			 WHERE id = $1`+q.version(version), q.args...)
 	if err != nil {
 		lgr.Error().Err(err).Msg("db query failed")
-		return err
+		return translate(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return p.unmatched(ctx, lgr, "posts", "post", id, version)
 	}
 
 	lgr.Debug().Msg("executed")
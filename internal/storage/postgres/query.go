@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"crud/internal/storage/query"
+	"strconv"
+	"strings"
+)
+
+// sortColumns maps sort fields onto expressions. Text is compared bytewise,
+// like the other backends do, whatever the database collation is.
+var sortColumns = map[string]string{
+	query.SortId:        "id",
+	query.SortName:      `name COLLATE "C"`,
+	query.SortTitle:     `title COLLATE "C"`,
+	query.SortCreatedAt: "created_at",
+}
+
+// sqlBuilder collects the arguments of a dynamic statement, and the
+// conditions of a keyset-paginated SELECT.
+type sqlBuilder struct {
+	where []string
+	args  []interface{}
+}
+
+func (q *sqlBuilder) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// version renders the compare-and-swap condition of a write, or nothing when
+// any version will do.
+func (q *sqlBuilder) version(version uint64) string {
+	if version == 0 {
+		return ""
+	}
+	return " AND version = " + q.arg(version)
+}
+
+func (q *sqlBuilder) filterPosts(f query.Filter) {
+	if f.AuthorId != 0 {
+		q.where = append(q.where, "author_id = "+q.arg(f.AuthorId))
+	}
+	if !f.CreatedFrom.IsZero() {
+		q.where = append(q.where, "created_at >= "+q.arg(f.CreatedFrom))
+	}
+	if !f.CreatedTo.IsZero() {
+		q.where = append(q.where, "created_at < "+q.arg(f.CreatedTo))
+	}
+	if f.TitlePrefix != "" {
+		q.where = append(q.where, "title LIKE "+q.arg(likePrefix(f.TitlePrefix)))
+	}
+}
+
+// after skips the rows up to and including the one the cursor points at.
+// cursorValue is the sort key of that row; it is ignored when sorting by id.
+func (q *sqlBuilder) after(opts query.Options, cursorValue interface{}) {
+	if opts.After == nil {
+		return
+	}
+
+	op := ">"
+	if opts.Order == query.Desc {
+		op = "<"
+	}
+
+	if opts.Sort == query.SortId {
+		q.where = append(q.where, "id "+op+" "+q.arg(opts.After.Id))
+		return
+	}
+	q.where = append(q.where, "("+sortColumns[opts.Sort]+", id) "+op+
+		" ("+q.arg(cursorValue)+", "+q.arg(opts.After.Id)+")")
+}
+
+// tail renders WHERE, ORDER BY and LIMIT. One extra row is fetched to find
+// out whether there is a next page.
+func (q *sqlBuilder) tail(opts query.Options) string {
+	var b strings.Builder
+
+	if len(q.where) > 0 {
+		b.WriteString("\n\t\t\t WHERE ")
+		b.WriteString(strings.Join(q.where, " AND "))
+	}
+
+	dir := " ASC"
+	if opts.Order == query.Desc {
+		dir = " DESC"
+	}
+	b.WriteString("\n\t\t\t ORDER BY ")
+	if opts.Sort != query.SortId {
+		b.WriteString(sortColumns[opts.Sort] + dir + ", ")
+	}
+	b.WriteString("id" + dir)
+
+	b.WriteString("\n\t\t\t LIMIT " + q.arg(opts.Limit+1))
+
+	return b.String()
+}
+
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
@@ -0,0 +1,131 @@
+// Package query describes the list options understood by every storage
+// backend: keyset pagination, sorting and filtering.
+package query
+
+import (
+	"crud/internal/entities"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+type Order string
+
+const (
+	Asc  Order = "asc"
+	Desc Order = "desc"
+)
+
+// Sort fields. Every sort is made total by falling back to the id, so the
+// cursor always points at exactly one row.
+const (
+	SortId        = "id"
+	SortName      = "name"
+	SortTitle     = "title"
+	SortCreatedAt = "created_at"
+)
+
+var (
+	AuthorSortFields = []string{SortId, SortName}
+	PostSortFields   = []string{SortId, SortTitle, SortCreatedAt}
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Filter narrows down a list of posts. Zero values mean "no filter".
+// CreatedFrom is inclusive and CreatedTo is exclusive.
+type Filter struct {
+	AuthorId    uint64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	TitlePrefix string
+}
+
+type Options struct {
+	Limit int
+	Sort  string
+	Order Order
+	// After is the decoded cursor of the previous page, nil for the first one.
+	After  *Cursor
+	Filter Filter
+}
+
+// Normalize fills in the defaults and clamps the limit.
+func (o Options) Normalize() Options {
+	if o.Limit <= 0 {
+		o.Limit = DefaultLimit
+	}
+	if o.Limit > MaxLimit {
+		o.Limit = MaxLimit
+	}
+	if o.Sort == "" {
+		o.Sort = SortId
+	}
+	if o.Order == "" {
+		o.Order = Asc
+	}
+	return o
+}
+
+// Cursor is the position of the last row of a page. It is bound to the sort
+// it was produced with, so it can't be replayed against another ordering.
+type Cursor struct {
+	Sort  string     `json:"s"`
+	Order Order      `json:"o"`
+	Id    uint64     `json:"i"`
+	Str   string     `json:"v,omitempty"`
+	Time  *time.Time `json:"t,omitempty"`
+}
+
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor returned by a previous page and checks that it
+// was produced by the same sort.
+func DecodeCursor(s string, sort string, order Order) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := new(Cursor)
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Order != order {
+		return nil, fmt.Errorf("%w: it was issued for sort=%s&order=%s", ErrInvalidCursor, c.Sort, c.Order)
+	}
+	if sort == SortCreatedAt && c.Time == nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func AuthorCursor(o Options, author entities.Author) *Cursor {
+	c := &Cursor{Sort: o.Sort, Order: o.Order, Id: author.Id}
+	if o.Sort == SortName {
+		c.Str = author.Name
+	}
+	return c
+}
+
+func PostCursor(o Options, post entities.Post) *Cursor {
+	c := &Cursor{Sort: o.Sort, Order: o.Order, Id: post.Id}
+	switch o.Sort {
+	case SortTitle:
+		c.Str = post.Title
+	case SortCreatedAt:
+		c.Time = &post.CreatedAt
+	}
+	return c
+}
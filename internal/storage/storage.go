@@ -4,25 +4,63 @@ import (
 	"context"
 	"crud/internal/config"
 	"crud/internal/entities"
+	"crud/internal/storage/errs"
+	"crud/internal/storage/memory"
+	"crud/internal/storage/migrate"
 	"crud/internal/storage/mongo"
 	"crud/internal/storage/postgres"
+	"crud/internal/storage/query"
+	"crud/pkg/metrics"
+	"crud/pkg/tracing"
+	"errors"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/rs/zerolog"
 	_mongo "go.mongodb.org/mongo-driver/mongo"
+	"time"
 )
 
+// migrateTimeout bounds waiting for the migration lock and migrating at
+// startup.
+const migrateTimeout = 5 * time.Minute
+
+// Error kinds returned by every backend, see package errs.
+var (
+	ErrNotFound     = errs.ErrNotFound
+	ErrConflict     = errs.ErrConflict
+	ErrForeignKey   = errs.ErrForeignKey
+	ErrInvalid      = errs.ErrInvalid
+	ErrUnavailable  = errs.ErrUnavailable
+	ErrPrecondition = errs.ErrPrecondition
+	ErrForbidden    = errs.ErrForbidden
+)
+
+// Writes are compare-and-swap on the version: Update takes the expected
+// version from the entity, Patch and Delete as an argument. Zero matches any
+// version. A mismatch fails with ErrPrecondition, while a missing row still
+// fails with ErrNotFound. Update sets the entity's version to the new one.
+
 type IAuthors interface {
 	Add(context.Context, *entities.Author) error
-	List(context.Context) ([]entities.Author, error)
+	// List returns a page of authors and the cursor of the next page, which
+	// is empty on the last one. Filters in query.Options don't apply to authors.
+	List(context.Context, query.Options) ([]entities.Author, string, error)
+	Get(context.Context, uint64) (*entities.Author, error)
 	Update(context.Context, *entities.Author) error
-	Delete(context.Context, uint64) error
+	// Patch writes only the fields set in the patch and returns the result.
+	Patch(ctx context.Context, id, version uint64, patch *entities.AuthorPatch) (*entities.Author, error)
+	Delete(ctx context.Context, id, version uint64) error
 }
 
 type IPosts interface {
 	Add(context.Context, *entities.Post) error
-	List(context.Context) ([]entities.Post, error)
+	// List returns a page of posts and the cursor of the next page, which is
+	// empty on the last one.
+	List(context.Context, query.Options) ([]entities.Post, string, error)
+	Get(context.Context, uint64) (*entities.Post, error)
 	Update(context.Context, *entities.Post) error
-	Delete(context.Context, uint64) error
+	// Patch writes only the fields set in the patch and returns the result.
+	Patch(ctx context.Context, id, version uint64, patch *entities.PostPatch) (*entities.Post, error)
+	Delete(ctx context.Context, id, version uint64) error
 }
 
 type Storage struct {
@@ -30,38 +68,118 @@ type Storage struct {
 	Posts    IPosts
 	pgConn   *pgxpool.Pool
 	mgClient *_mongo.Client
+	mgPool   *mongo.Pool
+	migrator *migrate.Migrator
 }
 
-func NewStorage(cfg *config.Config, lgr zerolog.Logger) *Storage {
+// NewStorage connects to the configured database. Calls and connection pools
+// are measured in reg, and calls are traced with tracer.
+func NewStorage(cfg *config.Snapshot, lgr zerolog.Logger, reg *metrics.Registry, tracer *tracing.Tracer) *Storage {
 	var (
 		authors  IAuthors
 		posts    IPosts
 		pgConn   *pgxpool.Pool
 		mgClient *_mongo.Client
+		mgPool   *mongo.Pool
+		drv      migrate.Driver
+		migrator *migrate.Migrator
 	)
 
-	switch cfg.Database.Name {
+	policy := cfg.Load().Database.AuthorDeletePolicy
+	switch policy {
+	case "", config.DeleteRestrict, config.DeleteCascade, config.DeleteOrphan:
+	default:
+		lgr.Fatal().Msgf("incorrect author delete policy: %s", policy)
+	}
+
+	switch cfg.Load().Database.Name {
 	case "postgres":
 		pgConn = postgres.NewConn(cfg, lgr)
 		authors = postgres.NewAuthors(cfg, lgr, pgConn)
 		posts = postgres.NewPosts(cfg, lgr, pgConn)
+		drv = postgres.NewMigrations(cfg, lgr, pgConn)
 	case "mongo":
 		var seqColl *_mongo.Collection
-		mgClient, seqColl = mongo.NewClient(cfg, lgr)
+		mgClient, seqColl, mgPool = mongo.NewClient(cfg, lgr)
 		authors = mongo.NewAuthors(cfg, lgr, mgClient, seqColl)
 		posts = mongo.NewPosts(cfg, lgr, mgClient)
+		drv = mongo.NewMigrations(cfg, lgr, mgClient)
+	case "memory":
+		memDB := memory.NewDB(cfg, lgr)
+		authors = memory.NewAuthors(cfg, lgr, memDB)
+		posts = memory.NewPosts(cfg, lgr, memDB)
 	default:
 		lgr.Fatal().Msg("incorrect database name")
 	}
 
+	in := newInstrument(cfg.Load().Database.Name, reg, tracer)
+	authors = instrumentedAuthors{next: authors, instrument: in}
+	posts = instrumentedPosts{next: posts, instrument: in}
+	if pgConn != nil {
+		registerPgPool(reg, pgConn)
+	}
+	if mgPool != nil {
+		registerMongoPool(reg, mgPool)
+	}
+
+	if drv != nil {
+		migrator = migrate.New(drv, lgr)
+		checkSchema(cfg, lgr, migrator)
+	}
+
 	return &Storage{
 		Authors:  authors,
 		Posts:    posts,
 		pgConn:   pgConn,
 		mgClient: mgClient,
+		mgPool:   mgPool,
+		migrator: migrator,
+	}
+}
+
+// checkSchema refuses to run against a schema other than the one this build
+// expects, unless auto_migrate is on and the database is merely behind.
+func checkSchema(cfg *config.Snapshot, lgr zerolog.Logger, m *migrate.Migrator) {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	err := m.Check(ctx)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, migrate.ErrMismatch) {
+		lgr.Fatal().Err(err).Msg("failed to read schema version")
+	}
+	if !cfg.Load().Database.AutoMigrate {
+		lgr.Fatal().Err(err).Msg("run \"migrate up\" or enable database.auto_migrate")
+	}
+
+	lgr.Info().Err(err).Msg("migrating")
+	if _, err = m.Up(ctx, 0); err != nil {
+		lgr.Fatal().Err(err).Msg("failed to migrate")
 	}
 }
 
+// NewMigrator connects to the configured database for the migrate command.
+// The memory database has no schema, so it gets a nil Migrator.
+func NewMigrator(cfg *config.Snapshot, lgr zerolog.Logger) (*migrate.Migrator, func()) {
+	switch cfg.Load().Database.Name {
+	case "postgres":
+		pgConn := postgres.NewConn(cfg, lgr)
+		return migrate.New(postgres.NewMigrations(cfg, lgr, pgConn), lgr), pgConn.Close
+	case "mongo":
+		mgClient, _, _ := mongo.NewClient(cfg, lgr)
+		return migrate.New(mongo.NewMigrations(cfg, lgr, mgClient), lgr), func() {
+			mgClient.Disconnect(context.TODO())
+		}
+	case "memory":
+		return nil, func() {}
+	}
+
+	lgr.Fatal().Msg("incorrect database name")
+	return nil, nil
+}
+
 func (s *Storage) Shutdown() {
 	if s.pgConn != nil {
 		s.pgConn.Close()
@@ -0,0 +1,1038 @@
+// Package storagetest is a conformance suite for storage.IAuthors and
+// storage.IPosts implementations. Every backend runs the same checks from its
+// own _test.go file so that their behaviour can't drift apart unnoticed.
+package storagetest
+
+import (
+	"context"
+	"crud/internal/config"
+	"crud/internal/entities"
+	"crud/internal/storage"
+	"crud/internal/storage/migrate"
+	"crud/internal/storage/query"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory returns a storage with empty authors and posts tables. It is called
+// once per subtest, so implementations should register any teardown with
+// t.Cleanup.
+type Factory func(t *testing.T) *storage.Storage
+
+const concurrentWriters = 16
+
+// RunAuthors checks the storage.IAuthors contract.
+func RunAuthors(t *testing.T, factory Factory) {
+	t.Run("AddAssignsIds", func(t *testing.T) {
+		stor := factory(t)
+
+		first := addAuthor(t, stor, "first")
+		second := addAuthor(t, stor, "second")
+		if first.Id == 0 || second.Id == 0 {
+			t.Fatalf("Add did not assign ids: %d, %d", first.Id, second.Id)
+		}
+		if second.Id <= first.Id {
+			t.Fatalf("ids are not increasing: %d then %d", first.Id, second.Id)
+		}
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, first, second)
+	})
+
+	t.Run("ListEmpty", func(t *testing.T) {
+		stor := factory(t)
+
+		authors := allAuthors(t, stor)
+		if len(authors) != 0 {
+			t.Fatalf("List returned %d authors from an empty table", len(authors))
+		}
+	})
+
+	t.Run("Paginate", func(t *testing.T) {
+		stor := factory(t)
+
+		// Duplicate names make the id tie-breaker matter.
+		var added []entities.Author
+		for _, name := range []string{"carol", "alice", "bob", "alice", "dave"} {
+			added = append(added, addAuthor(t, stor, name))
+		}
+
+		for _, order := range []query.Order{query.Asc, query.Desc} {
+			opts := query.Options{Limit: 2, Sort: query.SortName, Order: order}
+
+			var got []entities.Author
+			for pages := 0; ; pages++ {
+				if pages > len(added) {
+					t.Fatalf("order %s: pagination does not terminate", order)
+				}
+				authors, next, err := stor.Authors.List(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				if len(authors) > opts.Limit {
+					t.Fatalf("order %s: got %d authors with limit %d", order, len(authors), opts.Limit)
+				}
+				got = append(got, authors...)
+				if next == "" {
+					break
+				}
+				opts.After = decodeCursor(t, next, opts)
+			}
+
+			want := []entities.Author{added[1], added[3], added[2], added[0], added[4]}
+			if order == query.Desc {
+				want = []entities.Author{added[4], added[0], added[2], added[3], added[1]}
+			}
+			if len(got) != len(want) {
+				t.Fatalf("order %s: got %+v, want %+v", order, got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("order %s: got %+v, want %+v", order, got, want)
+				}
+			}
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		addAuthor(t, stor, "other")
+
+		got, err := stor.Authors.Get(ctx, author.Id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		assertAuthors(t, []entities.Author{*got}, author)
+
+		_, err = stor.Authors.Get(ctx, author.Id+1000)
+		assertKind(t, "Get", err, storage.ErrNotFound)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "before")
+		other := addAuthor(t, stor, "other")
+
+		author.Name = "after"
+		if err := stor.Authors.Update(ctx, &author); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, author, other)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "before")
+		other := addAuthor(t, stor, "other")
+
+		got, err := stor.Authors.Patch(ctx, author.Id, 0, &entities.AuthorPatch{})
+		if err != nil {
+			t.Fatalf("empty Patch: %v", err)
+		}
+		assertAuthors(t, []entities.Author{*got}, author)
+
+		name := "after"
+		got, err = stor.Authors.Patch(ctx, author.Id, 0, &entities.AuthorPatch{Name: &name})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+		author.Name = name
+		author.Version++
+		assertAuthors(t, []entities.Author{*got}, author)
+		assertAuthors(t, allAuthors(t, stor), author, other)
+
+		_, err = stor.Authors.Patch(ctx, author.Id+1000, 0, &entities.AuthorPatch{Name: &name})
+		assertKind(t, "Patch", err, storage.ErrNotFound)
+		_, err = stor.Authors.Patch(ctx, author.Id+1000, 0, &entities.AuthorPatch{})
+		assertKind(t, "empty Patch", err, storage.ErrNotFound)
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "v1")
+		if author.Version != 1 {
+			t.Fatalf("Add: got version %d, want 1", author.Version)
+		}
+		stale := author
+
+		author.Name = "v2"
+		if err := stor.Authors.Update(ctx, &author); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if author.Version != 2 {
+			t.Fatalf("Update: got version %d, want 2", author.Version)
+		}
+
+		stale.Name = "lost"
+		err := stor.Authors.Update(ctx, &stale)
+		assertKind(t, "stale Update", err, storage.ErrPrecondition)
+
+		name := "lost"
+		_, err = stor.Authors.Patch(ctx, author.Id, stale.Version, &entities.AuthorPatch{Name: &name})
+		assertKind(t, "stale Patch", err, storage.ErrPrecondition)
+		_, err = stor.Authors.Patch(ctx, author.Id, stale.Version, &entities.AuthorPatch{})
+		assertKind(t, "stale empty Patch", err, storage.ErrPrecondition)
+		err = stor.Authors.Delete(ctx, author.Id, stale.Version)
+		assertKind(t, "stale Delete", err, storage.ErrPrecondition)
+		assertAuthors(t, allAuthors(t, stor), author)
+
+		name = "v3"
+		got, err := stor.Authors.Patch(ctx, author.Id, author.Version, &entities.AuthorPatch{Name: &name})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+		author.Name = name
+		author.Version = 3
+		assertAuthors(t, []entities.Author{*got}, author)
+
+		// A missing row is reported as such whatever the version.
+		err = stor.Authors.Delete(ctx, author.Id+1000, author.Version)
+		assertKind(t, "Delete", err, storage.ErrNotFound)
+
+		if err = stor.Authors.Delete(ctx, author.Id, author.Version); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		assertAuthors(t, allAuthors(t, stor))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "deleted")
+		other := addAuthor(t, stor, "kept")
+
+		if err := stor.Authors.Delete(ctx, author.Id, 0); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, other)
+	})
+
+	t.Run("IdsAreNotReused", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "deleted")
+		if err := stor.Authors.Delete(ctx, author.Id, 0); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		next := addAuthor(t, stor, "next")
+		if next.Id <= author.Id {
+			t.Fatalf("id %d was handed out after %d had been used", next.Id, author.Id)
+		}
+	})
+
+	t.Run("MissingId", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "kept")
+		missing := author.Id + 1000
+
+		err := stor.Authors.Update(ctx, &entities.Author{Id: missing, Name: "ghost"})
+		assertKind(t, "Update", err, storage.ErrNotFound)
+		err = stor.Authors.Delete(ctx, missing, 0)
+		assertKind(t, "Delete", err, storage.ErrNotFound)
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, author)
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		added := make([]entities.Author, concurrentWriters)
+		errs := make([]error, concurrentWriters)
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrentWriters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				added[i] = entities.Author{Name: fmt.Sprintf("writer-%d", i)}
+				errs[i] = stor.Authors.Add(ctx, &added[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("Add from writer %d: %v", i, err)
+			}
+		}
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, added...)
+
+		// Everybody renames the same author; exactly one of the writes wins.
+		target := added[0]
+		for i := 0; i < concurrentWriters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = stor.Authors.Update(ctx, &entities.Author{Id: target.Id, Name: fmt.Sprintf("rename-%d", i)})
+			}(i)
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("Update from writer %d: %v", i, err)
+			}
+		}
+
+		authors = allAuthors(t, stor)
+		got, ok := findAuthor(authors, target.Id)
+		if !ok {
+			t.Fatalf("author %d disappeared after concurrent updates", target.Id)
+		}
+		var renamed bool
+		for i := 0; i < concurrentWriters; i++ {
+			renamed = renamed || got.Name == fmt.Sprintf("rename-%d", i)
+		}
+		if !renamed {
+			t.Fatalf("author %d has name %q, which none of the writers set", target.Id, got.Name)
+		}
+	})
+}
+
+// RunPosts checks the storage.IPosts contract, including the posts.author_id
+// foreign key to authors.
+func RunPosts(t *testing.T, factory Factory) {
+	t.Run("AddAssignsIds", func(t *testing.T) {
+		stor := factory(t)
+
+		author := addAuthor(t, stor, "author")
+		first := addPost(t, stor, author.Id, "first")
+		second := addPost(t, stor, author.Id, "second")
+		if first.Id == 0 || second.Id == 0 {
+			t.Fatalf("Add did not assign ids: %d, %d", first.Id, second.Id)
+		}
+		if second.Id <= first.Id {
+			t.Fatalf("ids are not increasing: %d then %d", first.Id, second.Id)
+		}
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, first, second)
+	})
+
+	t.Run("ListEmpty", func(t *testing.T) {
+		stor := factory(t)
+
+		posts := allPosts(t, stor)
+		if len(posts) != 0 {
+			t.Fatalf("List returned %d posts from an empty table", len(posts))
+		}
+	})
+
+	t.Run("Paginate", func(t *testing.T) {
+		stor := factory(t)
+
+		author := addAuthor(t, stor, "author")
+		base := time.Now().UTC().Truncate(time.Millisecond)
+
+		// Posts share timestamps so that the id tie-breaker matters.
+		var added []entities.Post
+		for i, offset := range []int{2, 0, 1, 0, 2, 1, 0} {
+			post := newPost(author.Id, fmt.Sprintf("post-%d", i))
+			post.CreatedAt = base.Add(time.Duration(offset) * time.Minute)
+			if err := stor.Posts.Add(context.Background(), post); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			added = append(added, *post)
+		}
+
+		for _, order := range []query.Order{query.Asc, query.Desc} {
+			opts := query.Options{Limit: 3, Sort: query.SortCreatedAt, Order: order}
+
+			var got []entities.Post
+			for pages := 0; ; pages++ {
+				if pages > len(added) {
+					t.Fatalf("order %s: pagination does not terminate", order)
+				}
+				posts, next, err := stor.Posts.List(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				if len(posts) > opts.Limit {
+					t.Fatalf("order %s: got %d posts with limit %d", order, len(posts), opts.Limit)
+				}
+				got = append(got, posts...)
+				if next == "" {
+					break
+				}
+				opts.After = decodeCursor(t, next, opts)
+			}
+
+			wantIdx := []int{1, 3, 6, 2, 5, 0, 4}
+			if order == query.Desc {
+				wantIdx = []int{4, 0, 5, 2, 6, 3, 1}
+			}
+			if len(got) != len(wantIdx) {
+				t.Fatalf("order %s: got %d posts, want %d", order, len(got), len(wantIdx))
+			}
+			for i, idx := range wantIdx {
+				if got[i].Id != added[idx].Id {
+					t.Fatalf("order %s: position %d holds post %d, want %d", order, i, got[i].Id, added[idx].Id)
+				}
+			}
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		stor := factory(t)
+
+		author := addAuthor(t, stor, "author")
+		other := addAuthor(t, stor, "other")
+		base := time.Now().UTC().Truncate(time.Millisecond)
+
+		add := func(authorId uint64, title string, offset time.Duration) entities.Post {
+			post := newPost(authorId, title)
+			post.CreatedAt = base.Add(offset)
+			if err := stor.Posts.Add(context.Background(), post); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			return *post
+		}
+		early := add(author.Id, "50%_off sale", 0)
+		middle := add(author.Id, "500 ideas", time.Hour)
+		late := add(author.Id, "50%_off again", 2*time.Hour)
+		foreign := add(other.Id, "50%_off elsewhere", time.Hour)
+
+		cases := []struct {
+			name   string
+			filter query.Filter
+			want   []entities.Post
+		}{
+			{"author", query.Filter{AuthorId: author.Id}, []entities.Post{early, middle, late}},
+			{"from", query.Filter{CreatedFrom: base.Add(time.Hour)}, []entities.Post{middle, late, foreign}},
+			{"to", query.Filter{CreatedTo: base.Add(time.Hour)}, []entities.Post{early}},
+			{"range", query.Filter{CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(2 * time.Hour)},
+				[]entities.Post{middle, foreign}},
+			{"prefix", query.Filter{TitlePrefix: "50%_"}, []entities.Post{early, late, foreign}},
+			{"combined", query.Filter{AuthorId: author.Id, TitlePrefix: "50%_", CreatedFrom: base.Add(time.Minute)},
+				[]entities.Post{late}},
+		}
+		for _, c := range cases {
+			posts, next, err := stor.Posts.List(context.Background(), query.Options{Filter: c.filter})
+			if err != nil {
+				t.Fatalf("%s: List: %v", c.name, err)
+			}
+			if next != "" {
+				t.Fatalf("%s: unexpected next cursor %q", c.name, next)
+			}
+			assertPosts(t, posts, c.want...)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		post := addPost(t, stor, author.Id, "post")
+		addPost(t, stor, author.Id, "other")
+
+		got, err := stor.Posts.Get(ctx, post.Id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		assertPosts(t, []entities.Post{*got}, post)
+
+		_, err = stor.Posts.Get(ctx, post.Id+1000)
+		assertKind(t, "Get", err, storage.ErrNotFound)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		newAuthor := addAuthor(t, stor, "new author")
+		post := addPost(t, stor, author.Id, "before")
+		other := addPost(t, stor, author.Id, "other")
+
+		post.AuthorId = newAuthor.Id
+		post.Title = "after"
+		post.Content = "updated content"
+		post.CreatedAt = post.CreatedAt.Add(time.Hour)
+		if err := stor.Posts.Update(ctx, &post); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, post, other)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		newAuthor := addAuthor(t, stor, "new author")
+		post := addPost(t, stor, author.Id, "before")
+		other := addPost(t, stor, author.Id, "other")
+
+		// Only the supplied fields change, the rest is left as is.
+		title := "after"
+		got, err := stor.Posts.Patch(ctx, post.Id, 0, &entities.PostPatch{Title: &title})
+		if err != nil {
+			t.Fatalf("Patch title: %v", err)
+		}
+		post.Title = title
+		post.Version++
+		assertPosts(t, []entities.Post{*got}, post)
+
+		createdAt := post.CreatedAt.Add(-time.Hour)
+		got, err = stor.Posts.Patch(ctx, post.Id, 0, &entities.PostPatch{
+			AuthorId:  &newAuthor.Id,
+			CreatedAt: &createdAt,
+		})
+		if err != nil {
+			t.Fatalf("Patch author_id and created_at: %v", err)
+		}
+		post.AuthorId = newAuthor.Id
+		post.CreatedAt = createdAt
+		post.Version++
+		assertPosts(t, []entities.Post{*got}, post)
+		assertPosts(t, allPosts(t, stor), post, other)
+
+		missingAuthor := newAuthor.Id + 1000
+		_, err = stor.Posts.Patch(ctx, post.Id, 0, &entities.PostPatch{AuthorId: &missingAuthor})
+		assertKind(t, "Patch", err, storage.ErrForeignKey)
+		assertPosts(t, allPosts(t, stor), post, other)
+
+		_, err = stor.Posts.Patch(ctx, post.Id+1000, 0, &entities.PostPatch{Title: &title})
+		assertKind(t, "Patch", err, storage.ErrNotFound)
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		post := addPost(t, stor, author.Id, "v1")
+		if post.Version != 1 {
+			t.Fatalf("Add: got version %d, want 1", post.Version)
+		}
+		stale := post
+
+		post.Title = "v2"
+		if err := stor.Posts.Update(ctx, &post); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if post.Version != 2 {
+			t.Fatalf("Update: got version %d, want 2", post.Version)
+		}
+
+		stale.Title = "lost"
+		err := stor.Posts.Update(ctx, &stale)
+		assertKind(t, "stale Update", err, storage.ErrPrecondition)
+
+		title := "lost"
+		_, err = stor.Posts.Patch(ctx, post.Id, stale.Version, &entities.PostPatch{Title: &title})
+		assertKind(t, "stale Patch", err, storage.ErrPrecondition)
+		err = stor.Posts.Delete(ctx, post.Id, stale.Version)
+		assertKind(t, "stale Delete", err, storage.ErrPrecondition)
+		assertPosts(t, allPosts(t, stor), post)
+
+		title = "v3"
+		got, err := stor.Posts.Patch(ctx, post.Id, post.Version, &entities.PostPatch{Title: &title})
+		if err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+		post.Title = title
+		post.Version = 3
+		assertPosts(t, []entities.Post{*got}, post)
+
+		err = stor.Posts.Delete(ctx, post.Id+1000, post.Version)
+		assertKind(t, "Delete", err, storage.ErrNotFound)
+
+		if err = stor.Posts.Delete(ctx, post.Id, post.Version); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		assertPosts(t, allPosts(t, stor))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		post := addPost(t, stor, author.Id, "deleted")
+		other := addPost(t, stor, author.Id, "kept")
+
+		if err := stor.Posts.Delete(ctx, post.Id, 0); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, other)
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, author)
+	})
+
+	t.Run("MissingId", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		post := addPost(t, stor, author.Id, "kept")
+		missing := post.Id + 1000
+
+		err := stor.Posts.Update(ctx, &entities.Post{
+			Id:        missing,
+			AuthorId:  author.Id,
+			Title:     "ghost",
+			Content:   "ghost",
+			CreatedAt: post.CreatedAt,
+		})
+		assertKind(t, "Update", err, storage.ErrNotFound)
+		err = stor.Posts.Delete(ctx, missing, 0)
+		assertKind(t, "Delete", err, storage.ErrNotFound)
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, post)
+	})
+
+	t.Run("ForeignKeyOnAdd", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		err := stor.Posts.Add(ctx, newPost(author.Id+1000, "orphan"))
+		assertKind(t, "Add", err, storage.ErrForeignKey)
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts)
+	})
+
+	t.Run("ForeignKeyOnUpdate", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		post := addPost(t, stor, author.Id, "post")
+
+		changed := post
+		changed.AuthorId = author.Id + 1000
+		changed.Title = "orphan"
+		err := stor.Posts.Update(ctx, &changed)
+		assertKind(t, "Update", err, storage.ErrForeignKey)
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, post)
+	})
+
+	t.Run("ForeignKeyOnAuthorDelete", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+		post := addPost(t, stor, author.Id, "post")
+
+		err := stor.Authors.Delete(ctx, author.Id, 0)
+		assertKind(t, "Delete", err, storage.ErrForeignKey)
+
+		authors := allAuthors(t, stor)
+		assertAuthors(t, authors, author)
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, post)
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		stor := factory(t)
+		ctx := context.Background()
+
+		author := addAuthor(t, stor, "author")
+
+		added := make([]entities.Post, concurrentWriters)
+		errs := make([]error, concurrentWriters)
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrentWriters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				added[i] = *newPost(author.Id, fmt.Sprintf("writer-%d", i))
+				errs[i] = stor.Posts.Add(ctx, &added[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("Add from writer %d: %v", i, err)
+			}
+		}
+
+		posts := allPosts(t, stor)
+		assertPosts(t, posts, added...)
+
+		// Half of the writers delete their post while the other half update it.
+		for i := 0; i < concurrentWriters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i%2 == 0 {
+					errs[i] = stor.Posts.Delete(ctx, added[i].Id, 0)
+					return
+				}
+				added[i].Title = fmt.Sprintf("updated-%d", i)
+				errs[i] = stor.Posts.Update(ctx, &added[i])
+			}(i)
+		}
+		wg.Wait()
+
+		expected := make([]entities.Post, 0, concurrentWriters/2)
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("writer %d: %v", i, err)
+			}
+			if i%2 == 1 {
+				expected = append(expected, added[i])
+			}
+		}
+
+		posts = allPosts(t, stor)
+		assertPosts(t, posts, expected...)
+	})
+}
+
+// RunDeletePolicy checks what deleting an author with posts does under the
+// given config.Database.AuthorDeletePolicy, which factory must apply.
+func RunDeletePolicy(t *testing.T, policy string, factory Factory) {
+	stor := factory(t)
+	ctx := context.Background()
+
+	author := addAuthor(t, stor, "author")
+	other := addAuthor(t, stor, "other")
+	posts := []entities.Post{
+		addPost(t, stor, author.Id, "first"),
+		addPost(t, stor, author.Id, "second"),
+	}
+	kept := addPost(t, stor, other.Id, "kept")
+
+	err := stor.Authors.Delete(ctx, author.Id, 0)
+
+	switch policy {
+	case config.DeleteCascade:
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		assertAuthors(t, allAuthors(t, stor), other)
+		assertPosts(t, allPosts(t, stor), kept)
+
+	case config.DeleteOrphan:
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		assertAuthors(t, allAuthors(t, stor), other)
+		// Orphaning is a write, so it moves the posts to a new version.
+		for i := range posts {
+			posts[i].AuthorId = 0
+			posts[i].Version++
+		}
+		assertPosts(t, allPosts(t, stor), append(posts, kept)...)
+
+	default:
+		assertKind(t, "Delete", err, storage.ErrForeignKey)
+		assertAuthors(t, allAuthors(t, stor), author, other)
+		assertPosts(t, allPosts(t, stor), append(posts, kept)...)
+	}
+
+	// Without posts every policy simply deletes the author.
+	if err = stor.Posts.Delete(ctx, kept.Id, 0); err != nil {
+		t.Fatalf("Delete post: %v", err)
+	}
+	if err = stor.Authors.Delete(ctx, other.Id, 0); err != nil {
+		t.Fatalf("Delete author without posts: %v", err)
+	}
+	err = stor.Authors.Delete(ctx, other.Id, 0)
+	assertKind(t, "Delete", err, storage.ErrNotFound)
+
+	// A post added while its author is deleted either makes the delete
+	// follow the policy or fails itself, it never references a deleted
+	// author.
+	for i := 0; i < concurrentWriters; i++ {
+		author := addAuthor(t, stor, fmt.Sprintf("raced-%d", i))
+
+		var (
+			wg                sync.WaitGroup
+			addErr, deleteErr error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			addErr = stor.Posts.Add(ctx, newPost(author.Id, fmt.Sprintf("raced-%d", i)))
+		}()
+		go func() {
+			defer wg.Done()
+			deleteErr = stor.Authors.Delete(ctx, author.Id, 0)
+		}()
+		wg.Wait()
+
+		if addErr != nil && !errors.Is(addErr, storage.ErrForeignKey) {
+			t.Fatalf("Add while deleting the author: %v", addErr)
+		}
+		if deleteErr != nil && !errors.Is(deleteErr, storage.ErrForeignKey) {
+			t.Fatalf("Delete while adding a post: %v", deleteErr)
+		}
+	}
+
+	authors := make(map[uint64]bool)
+	for _, author := range allAuthors(t, stor) {
+		authors[author.Id] = true
+	}
+	for _, post := range allPosts(t, stor) {
+		if post.AuthorId != 0 && !authors[post.AuthorId] {
+			t.Errorf("post %d references deleted author %d", post.Id, post.AuthorId)
+		}
+	}
+}
+
+// RunMigrations walks the schema all the way down and up again, so it wipes
+// the database. It leaves it fully migrated.
+func RunMigrations(t *testing.T, m *migrate.Migrator) {
+	ctx := context.Background()
+
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	status := migrationStatus(t, m)
+	steps := status.Applied
+	if len(status.Pending) > 0 || status.Current != status.Latest || len(steps) == 0 {
+		t.Fatalf("after Up: %+v", status)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Fatalf("Check after Up: %v", err)
+	}
+
+	reverted, err := m.Down(ctx, len(steps))
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(reverted) != len(steps) || reverted[0] != steps[len(steps)-1] {
+		t.Fatalf("Down reverted %v, want %v in reverse", reverted, steps)
+	}
+	if status = migrationStatus(t, m); status.Current != 0 || len(status.Pending) != len(steps) {
+		t.Fatalf("after Down: %+v", status)
+	}
+
+	applied, err := m.Up(ctx, 1)
+	if err != nil {
+		t.Fatalf("Up 1: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != steps[0] {
+		t.Fatalf("Up 1 applied %v, want %v", applied, steps[:1])
+	}
+	if err = m.Check(ctx); len(steps) > 1 && !errors.Is(err, migrate.ErrMismatch) {
+		t.Fatalf("Check with pending migrations: got %v, want %v", err, migrate.ErrMismatch)
+	}
+
+	// Concurrent runs are serialised by the lock, so every pending step is
+	// applied exactly once.
+	const runners = 4
+	var (
+		wg    sync.WaitGroup
+		total = make([]int, runners)
+		errs  = make([]error, runners)
+	)
+	for i := 0; i < runners; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			applied, err := m.Up(ctx, 0)
+			total[i], errs[i] = len(applied), err
+		}(i)
+	}
+	wg.Wait()
+
+	sum := 0
+	for i := range errs {
+		if errs[i] != nil {
+			t.Fatalf("concurrent Up: %v", errs[i])
+		}
+		sum += total[i]
+	}
+	if sum != len(steps)-1 {
+		t.Fatalf("concurrent Up applied %d steps, want %d", sum, len(steps)-1)
+	}
+	if err = m.Check(ctx); err != nil {
+		t.Fatalf("Check after concurrent Up: %v", err)
+	}
+}
+
+func migrationStatus(t *testing.T, m *migrate.Migrator) *migrate.Status {
+	t.Helper()
+
+	status, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	return status
+}
+
+func addAuthor(t *testing.T, stor *storage.Storage, name string) entities.Author {
+	t.Helper()
+
+	author := entities.Author{Name: name}
+	if err := stor.Authors.Add(context.Background(), &author); err != nil {
+		t.Fatalf("add author %q: %v", name, err)
+	}
+	return author
+}
+
+func addPost(t *testing.T, stor *storage.Storage, authorId uint64, title string) entities.Post {
+	t.Helper()
+
+	post := newPost(authorId, title)
+	if err := stor.Posts.Add(context.Background(), post); err != nil {
+		t.Fatalf("add post %q: %v", title, err)
+	}
+	return *post
+}
+
+// newPost uses a millisecond-precision UTC timestamp, the finest resolution
+// every backend can round-trip.
+func newPost(authorId uint64, title string) *entities.Post {
+	return &entities.Post{
+		AuthorId:  authorId,
+		Title:     title,
+		Content:   "content of " + title,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+func findAuthor(authors []entities.Author, id uint64) (entities.Author, bool) {
+	for _, author := range authors {
+		if author.Id == id {
+			return author, true
+		}
+	}
+	return entities.Author{}, false
+}
+
+func assertAuthors(t *testing.T, got []entities.Author, want ...entities.Author) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d authors, want %d: %+v", len(got), len(want), got)
+	}
+	for _, w := range want {
+		g, ok := findAuthor(got, w.Id)
+		if !ok {
+			t.Fatalf("author %d is missing from %+v", w.Id, got)
+		}
+		if g != w {
+			t.Fatalf("author %d: got %+v, want %+v", w.Id, g, w)
+		}
+	}
+}
+
+func assertPosts(t *testing.T, got []entities.Post, want ...entities.Post) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d posts, want %d: %+v", len(got), len(want), got)
+	}
+	for _, w := range want {
+		var (
+			g  entities.Post
+			ok bool
+		)
+		for _, post := range got {
+			if post.Id == w.Id {
+				g, ok = post, true
+				break
+			}
+		}
+		if !ok {
+			t.Fatalf("post %d is missing from %+v", w.Id, got)
+		}
+		if g.AuthorId != w.AuthorId || g.Title != w.Title || g.Content != w.Content ||
+			!g.CreatedAt.Equal(w.CreatedAt) || g.Version != w.Version {
+			t.Fatalf("post %d: got %+v, want %+v", w.Id, g, w)
+		}
+	}
+}
+
+func assertKind(t *testing.T, api string, err, kind error) {
+	t.Helper()
+
+	if !errors.Is(err, kind) {
+		t.Fatalf("%s returned %v, want %v", api, err, kind)
+	}
+}
+
+// allAuthors and allPosts walk every page of the default ordering.
+func allAuthors(t *testing.T, stor *storage.Storage) []entities.Author {
+	t.Helper()
+
+	var (
+		all  []entities.Author
+		opts query.Options
+	)
+	for {
+		authors, next, err := stor.Authors.List(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		all = append(all, authors...)
+		if next == "" {
+			return all
+		}
+		opts.After = decodeCursor(t, next, opts)
+	}
+}
+
+func allPosts(t *testing.T, stor *storage.Storage) []entities.Post {
+	t.Helper()
+
+	var (
+		all  []entities.Post
+		opts query.Options
+	)
+	for {
+		posts, next, err := stor.Posts.List(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		all = append(all, posts...)
+		if next == "" {
+			return all
+		}
+		opts.After = decodeCursor(t, next, opts)
+	}
+}
+
+func decodeCursor(t *testing.T, next string, opts query.Options) *query.Cursor {
+	t.Helper()
+
+	opts = opts.Normalize()
+	c, err := query.DecodeCursor(next, opts.Sort, opts.Order)
+	if err != nil {
+		t.Fatalf("decode cursor %q: %v", next, err)
+	}
+	return c
+}
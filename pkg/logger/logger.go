@@ -33,14 +33,16 @@ func init() {
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 }
 
+// NewLogger returns a logger writing to w. The level is the global zerolog
+// one, so that SetLevel applies to every logger derived from it.
 func NewLogger(w io.Writer, logLevel string) (zerolog.Logger, error) {
-	lvl, err := zerolog.ParseLevel(logLevel)
+	lvl, err := SetLevel(logLevel)
 	if err != nil {
 		return zerolog.Logger{}, err
 	}
 
 	logger := zerolog.New(w).
-		Level(lvl).With().
+		With().
 		Timestamp().
 		Logger()
 
@@ -50,3 +52,16 @@ func NewLogger(w io.Writer, logLevel string) (zerolog.Logger, error) {
 
 	return logger, nil
 }
+
+// SetLevel changes the level of every logger at once, e.g. on a config
+// reload.
+func SetLevel(logLevel string) (zerolog.Level, error) {
+	lvl, err := zerolog.ParseLevel(logLevel)
+	if err != nil {
+		return zerolog.NoLevel, err
+	}
+
+	zerolog.SetGlobalLevel(lvl)
+
+	return lvl, nil
+}
@@ -0,0 +1,220 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+)
+
+// Redaction modes, for the value of a field that is not logged as it is.
+const (
+	// RedactMask replaces the value with a placeholder.
+	RedactMask = "mask"
+	// RedactHash replaces the value with a hash of it, so that lines about
+	// the same value can still be matched.
+	RedactHash = "hash"
+	// RedactDrop leaves the field out.
+	RedactDrop = "drop"
+)
+
+const (
+	redactedValue = "[redacted]"
+	hashPrefix    = "hash:"
+	// hashBytes is how much of the hash is kept, enough to tell values apart.
+	hashBytes = 8
+)
+
+// Redaction says how the fields of user data added with Dict are logged.
+type Redaction struct {
+	// Allow, if not empty, lists the only fields logged as they are.
+	Allow []string
+	// Deny lists fields never logged as they are, even if allowed.
+	Deny []string
+	// Mode is one of RedactMask, RedactHash or RedactDrop, the default.
+	Mode string
+	// MaxLength truncates longer strings, counted in characters. Zero keeps
+	// them whole.
+	MaxLength int
+	// HashKey makes RedactHash use an HMAC, so that short values can't be
+	// found by hashing guesses.
+	HashKey string
+}
+
+type redactor struct {
+	allow     map[string]bool
+	deny      map[string]bool
+	mode      string
+	maxLength int
+	hashKey   []byte
+}
+
+// redaction is shared by every logger, like the level. Without SetRedaction
+// everything is logged as it is.
+var redaction atomic.Pointer[redactor]
+
+func init() {
+	redaction.Store(&redactor{})
+}
+
+// SetRedaction changes how every Dict is logged from now on.
+func SetRedaction(r Redaction) error {
+	switch r.Mode {
+	case RedactMask, RedactHash, RedactDrop:
+	case "":
+		r.Mode = RedactDrop
+	default:
+		return fmt.Errorf("unknown redaction mode %q", r.Mode)
+	}
+	if r.MaxLength < 0 {
+		return fmt.Errorf("negative redaction max length %d", r.MaxLength)
+	}
+
+	red := &redactor{
+		allow:     set(r.Allow),
+		deny:      set(r.Deny),
+		mode:      r.Mode,
+		maxLength: r.MaxLength,
+	}
+	if r.HashKey != "" {
+		red.hashKey = []byte(r.HashKey)
+	}
+	redaction.Store(red)
+
+	return nil
+}
+
+func set(items []string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, item := range items {
+		m[item] = true
+	}
+	return m
+}
+
+func (r *redactor) allowed(key string) bool {
+	if r.deny[key] {
+		return false
+	}
+	return len(r.allow) == 0 || r.allow[key]
+}
+
+func (r *redactor) truncate(s string) string {
+	if r.maxLength == 0 || utf8.RuneCountInString(s) <= r.maxLength {
+		return s
+	}
+	n := 0
+	for i := range s {
+		if n == r.maxLength {
+			return s[:i] + "…"
+		}
+		n++
+	}
+	return s
+}
+
+func (r *redactor) hash(s string) string {
+	var sum []byte
+	if r.hashKey != nil {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(s))
+		sum = mac.Sum(nil)
+	} else {
+		h := sha256.Sum256([]byte(s))
+		sum = h[:]
+	}
+	return hashPrefix + hex.EncodeToString(sum[:hashBytes])
+}
+
+// Fields is a set of fields from user data, redacted when it is logged.
+type Fields struct {
+	fields []dictField
+}
+
+type dictField struct {
+	key   string
+	value interface{}
+}
+
+// Dict starts a set of fields to pass to Object, in place of zerolog.Dict
+// and Dict, for anything a client sent.
+func Dict() *Fields {
+	return new(Fields)
+}
+
+func (f *Fields) Str(key, value string) *Fields {
+	return f.add(key, value)
+}
+
+func (f *Fields) Strs(key string, value []string) *Fields {
+	return f.add(key, value)
+}
+
+func (f *Fields) Int(key string, value int) *Fields {
+	return f.add(key, value)
+}
+
+func (f *Fields) Uint64(key string, value uint64) *Fields {
+	return f.add(key, value)
+}
+
+func (f *Fields) Time(key string, value time.Time) *Fields {
+	return f.add(key, value)
+}
+
+func (f *Fields) add(key string, value interface{}) *Fields {
+	f.fields = append(f.fields, dictField{key: key, value: value})
+	return f
+}
+
+func (f *Fields) MarshalZerologObject(e *zerolog.Event) {
+	r := redaction.Load()
+
+	for _, field := range f.fields {
+		if !r.allowed(field.key) {
+			switch r.mode {
+			case RedactMask:
+				e.Str(field.key, redactedValue)
+			case RedactHash:
+				e.Str(field.key, r.hash(text(field.value)))
+			}
+			continue
+		}
+
+		switch value := field.value.(type) {
+		case string:
+			e.Str(field.key, r.truncate(value))
+		case []string:
+			truncated := make([]string, len(value))
+			for i, s := range value {
+				truncated[i] = r.truncate(s)
+			}
+			e.Strs(field.key, truncated)
+		case int:
+			e.Int(field.key, value)
+		case uint64:
+			e.Uint64(field.key, value)
+		case time.Time:
+			e.Time(field.key, value)
+		}
+	}
+}
+
+// text is what a value is hashed as.
+func text(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, ",")
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,91 @@
+package logger_test
+
+import (
+	"bytes"
+	"crud/pkg/logger"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func logRequest(t *testing.T, r logger.Redaction, fields *logger.Fields) map[string]interface{} {
+	t.Helper()
+	if err := logger.SetRedaction(r); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.SetRedaction(logger.Redaction{}) })
+
+	var buf bytes.Buffer
+	lgr := zerolog.New(&buf)
+	lgr.Log().Object("request", fields).Send()
+
+	var line struct {
+		Request map[string]interface{} `json:"request"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	return line.Request
+}
+
+func post() *logger.Fields {
+	return logger.Dict().
+		Uint64("id", 7).
+		Str("title", "Hello").
+		Str("content", "some private text")
+}
+
+func TestRedactionDeny(t *testing.T) {
+	got := logRequest(t, logger.Redaction{Deny: []string{"content"}, Mode: logger.RedactMask}, post())
+	if got["id"] != float64(7) || got["title"] != "Hello" || got["content"] != "[redacted]" {
+		t.Errorf("got %v", got)
+	}
+
+	got = logRequest(t, logger.Redaction{Deny: []string{"content"}}, post())
+	if _, ok := got["content"]; ok || got["title"] != "Hello" {
+		t.Errorf("got %v, want content dropped", got)
+	}
+}
+
+func TestRedactionAllow(t *testing.T) {
+	got := logRequest(t, logger.Redaction{Allow: []string{"id", "content"}, Deny: []string{"content"}}, post())
+	if len(got) != 1 || got["id"] != float64(7) {
+		t.Errorf("got %v, want only id", got)
+	}
+}
+
+func TestRedactionHash(t *testing.T) {
+	r := logger.Redaction{Deny: []string{"title"}, Mode: logger.RedactHash}
+	first := logRequest(t, r, post())["title"].(string)
+	second := logRequest(t, r, post())["title"].(string)
+	if !strings.HasPrefix(first, "hash:") || first != second {
+		t.Errorf("got %q and %q, want the same hash", first, second)
+	}
+
+	r.HashKey = "key"
+	keyed := logRequest(t, r, post())["title"].(string)
+	if keyed == first {
+		t.Error("the hash key was ignored")
+	}
+}
+
+func TestRedactionTruncate(t *testing.T) {
+	fields := logger.Dict().
+		Str("title", "héllo world").
+		Strs("tags", []string{"short", "longer one"})
+	got := logRequest(t, logger.Redaction{MaxLength: 5}, fields)
+	if got["title"] != "héllo…" {
+		t.Errorf("got %q", got["title"])
+	}
+	if tags := got["tags"].([]interface{}); tags[0] != "short" || tags[1] != "longe…" {
+		t.Errorf("got %q", tags)
+	}
+}
+
+func TestSetRedactionBadMode(t *testing.T) {
+	if err := logger.SetRedaction(logger.Redaction{Mode: "scramble"}); err == nil {
+		t.Error("an unknown mode was accepted")
+	}
+}
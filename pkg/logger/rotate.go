@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat suffixes rotated files, so that they sort by age.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// RotateOptions say when a RotatingFile starts a new file and how long it
+// keeps the old ones. Zero values disable the corresponding limit.
+type RotateOptions struct {
+	// MaxSize is the size in bytes a file may reach.
+	MaxSize int64
+	// Every is how long a file is written to.
+	Every time.Duration
+	// MaxBackups is how many rotated files are kept.
+	MaxBackups int
+	// MaxAge is how long rotated files are kept.
+	MaxAge time.Duration
+}
+
+// RotatingFile appends to a file, which it renames to path.<time> when it
+// gets too big or too old, and removes the rotated files beyond retention.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func NewRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	// A failed rotation still leaves a file to write to, the line goes there
+	// and the error is reported.
+	var rotateErr error
+	if f.due(len(p)) {
+		if rotateErr = f.rotate(); f.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// due tells whether the file must be rotated before writing n bytes. An
+// empty file is never rotated, so that a line bigger than MaxSize is still
+// written.
+func (f *RotatingFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+int64(n) > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.Every > 0 && time.Since(f.opened) >= f.opts.Every
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	backup := f.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		// Append to the file again, rotation is retried on the next write.
+		f.file = nil
+		if openErr := f.open(); openErr != nil {
+			return fmt.Errorf("rotate %s: %w, reopen: %v", f.path, err, openErr)
+		}
+		return fmt.Errorf("rotate %s: %w", f.path, err)
+	}
+	f.file = nil
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	return f.prune()
+}
+
+// prune removes the rotated files beyond MaxBackups or older than MaxAge.
+func (f *RotatingFile) prune() error {
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	// Newest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, backup := range backups {
+		remove := f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups
+		if !remove && f.opts.MaxAge > 0 {
+			info, err := os.Stat(backup)
+			remove = err == nil && time.Since(info.ModTime()) > f.opts.MaxAge
+		}
+		if remove {
+			if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
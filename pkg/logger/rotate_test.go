@@ -0,0 +1,107 @@
+package logger_test
+
+import (
+	"crud/pkg/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crud.log")
+	f, err := logger.NewRotatingFile(path, logger.RotateOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n", "a line longer than 10\n"} {
+		if _, err = f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// Rotated files are named after the time.
+		time.Sleep(time.Millisecond)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "a line longer than 10\n" {
+		t.Errorf("current file holds %q", got)
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("got backups %v, want 2", backups)
+	}
+	if got, _ := os.ReadFile(backups[1]); string(got) != "fourth\n" {
+		t.Errorf("newest backup holds %q", got)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "crud.log")
+
+	old := path + ".20000101T000000.000000000"
+	if err := os.WriteFile(old, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(old, past, past)
+
+	f, err := logger.NewRotatingFile(path, logger.RotateOptions{Every: time.Nanosecond, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("one\n"))
+	f.Write([]byte("two\n"))
+
+	if _, err = os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expired backup kept: %v", err)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Errorf("got backups %v, want 1", backups)
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crud.log")
+	f, err := logger.NewRotatingFile(path, logger.RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err = f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The file to rotate is gone, so the rename fails.
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("second\n")); err == nil {
+		t.Error("got no error for the failed rotation")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "second\n" {
+		t.Errorf("current file holds %q, want the line written anyway", got)
+	}
+
+	// The next write rotates.
+	time.Sleep(time.Millisecond)
+	if _, err = f.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("got backups %v, want 1", backups)
+	}
+	if got, _ := os.ReadFile(backups[0]); string(got) != "second\n" {
+		t.Errorf("backup holds %q", got)
+	}
+}
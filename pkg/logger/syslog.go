@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// SyslogWriter is a zerolog writer sending each line to syslog with the
+// severity of its level.
+type SyslogWriter struct {
+	zerolog.LevelWriter
+	w *syslog.Writer
+}
+
+// NewSyslog connects to the syslog daemon listening on the Unix socket at
+// path, either datagram or stream, and tags messages with tag.
+func NewSyslog(path, tag string) (*SyslogWriter, error) {
+	w, err := syslog.Dial("unixgram", path, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		w, err = syslog.Dial("unix", path, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogWriter{LevelWriter: zerolog.SyslogLevelWriter(w), w: w}, nil
+}
+
+func (s *SyslogWriter) Close() error {
+	return s.w.Close()
+}
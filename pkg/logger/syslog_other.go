@@ -0,0 +1,23 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+)
+
+// SyslogWriter is not available on this platform, see NewSyslog.
+type SyslogWriter struct {
+	zerolog.LevelWriter
+}
+
+// NewSyslog always fails, there is no syslog on this platform.
+func NewSyslog(path, tag string) (*SyslogWriter, error) {
+	return nil, errors.New("syslog is unsupported on this platform")
+}
+
+func (s *SyslogWriter) Close() error {
+	return nil
+}
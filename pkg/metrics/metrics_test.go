@@ -0,0 +1,90 @@
+package metrics_test
+
+import (
+	"crud/pkg/metrics"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCounter(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.Counter("requests_total", "Requests.", "route", "status")
+	c.Inc("/posts", "200")
+	c.Inc("/posts", "200")
+	c.Add(3, "/a\"b\\c\nd", "500")
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/a\"b\\c\nd",status="500"} 3
+requests_total{route="/posts",status="200"} 2
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	reg := metrics.NewRegistry()
+	h := reg.Histogram("duration_seconds", "Durations.", []float64{1, 0.1}, "api")
+	h.Observe(0.05, "Get")
+	h.Observe(0.5, "Get")
+	h.Observe(2, "Get")
+
+	want := `# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{api="Get",le="0.1"} 1
+duration_seconds_bucket{api="Get",le="1"} 2
+duration_seconds_bucket{api="Get",le="+Inf"} 3
+duration_seconds_sum{api="Get"} 2.55
+duration_seconds_count{api="Get"} 3
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	reg := metrics.NewRegistry()
+	open := 4
+	reg.GaugeFunc("open_conns", "Open connections.", func(emit func(float64, ...string)) {
+		emit(float64(open))
+	})
+	reg.CounterFunc("acquires_total", "Acquisitions.", func(emit func(float64, ...string)) {
+		emit(10, "a")
+		emit(20, "b")
+	}, "pool")
+
+	open = 5
+	want := `# HELP open_conns Open connections.
+# TYPE open_conns gauge
+open_conns 5
+# HELP acquires_total Acquisitions.
+# TYPE acquires_total counter
+acquires_total{pool="a"} 10
+acquires_total{pool="b"} 20
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("x_total", "X.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	reg.Counter("x_total", "X again.")
+}
@@ -0,0 +1,157 @@
+// Package ratelimit keeps token buckets by key. Limits are given on every
+// call rather than fixed per bucket, so that they can change at runtime.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit lets Burst requests through at once, then Rate per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited tells whether l lets everything through.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// ParseLimit reads "rate[/unit][:burst]", such as "10", "120/m" or
+// "5/s:20". The unit is s, m or h, and defaults to s. The burst defaults
+// to the rate per second, at least 1. "0" is Unlimited.
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	count, unit, hasUnit := strings.Cut(rate, "/")
+
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) {
+		return Limit{}, fmt.Errorf("limit %q: bad rate %q", s, count)
+	}
+	per := time.Second
+	if hasUnit {
+		switch unit {
+		case "s":
+		case "m":
+			per = time.Minute
+		case "h":
+			per = time.Hour
+		default:
+			return Limit{}, fmt.Errorf("limit %q: unit %q is not s, m or h", s, unit)
+		}
+	}
+
+	l := Limit{Rate: n / per.Seconds()}
+	if !hasBurst {
+		l.Burst = int(math.Max(1, math.Ceil(l.Rate)))
+		return l, nil
+	}
+	if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst < 1 {
+		return Limit{}, fmt.Errorf("limit %q: bad burst %q", s, burst)
+	}
+	return l, nil
+}
+
+// Result is what Allow decided, with what the RateLimit-* headers report.
+type Result struct {
+	Allowed bool
+	// Remaining is how many requests could follow at once.
+	Remaining int
+	// Reset is when the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is when the next request is let through, zero if Allowed.
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// full tells whether b would be full at now, and can be forgotten.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// sweepEvery is how often idle buckets are dropped.
+const sweepEvery = time.Minute
+
+// Limiter holds a bucket per key. Its zero value is not usable, see New.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New() *Limiter {
+	return NewWithClock(time.Now)
+}
+
+// NewWithClock is New with another clock, for tests.
+func NewWithClock(now func() time.Time) *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), lastSweep: now(), now: now}
+}
+
+// Allow takes a token from the bucket of key, filled at limit. A bucket
+// whose limit changed keeps its tokens, up to the new burst.
+func (l *Limiter) Allow(key string, limit Limit) Result {
+	if limit.Unlimited() {
+		return Result{Allowed: true, Remaining: limit.Burst}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepEvery {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+
+	var res Result
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	return res
+}
+
+// sweep drops the buckets that filled up, they are as good as new.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Len is the number of buckets held.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
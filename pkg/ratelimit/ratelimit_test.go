@@ -0,0 +1,71 @@
+package ratelimit_test
+
+import (
+	"crud/pkg/ratelimit"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	for s, want := range map[string]ratelimit.Limit{
+		"10":     {Rate: 10, Burst: 10},
+		"5/s:20": {Rate: 5, Burst: 20},
+		"120/m":  {Rate: 2, Burst: 2},
+		"36/h:3": {Rate: 0.01, Burst: 3},
+		"0.5":    {Rate: 0.5, Burst: 1},
+		"0":      {Rate: 0, Burst: 1},
+	} {
+		got, err := ratelimit.ParseLimit(s)
+		if err != nil || got != want {
+			t.Errorf("%q: got %+v, %v, want %+v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "fast", "-1", "10/d", "10:0", "10:x"} {
+		if _, err := ratelimit.ParseLimit(s); err == nil {
+			t.Errorf("%q was accepted", s)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := ratelimit.NewWithClock(func() time.Time { return now })
+	limit := ratelimit.Limit{Rate: 2, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		if res := l.Allow("a", limit); !res.Allowed || res.Remaining != i {
+			t.Fatalf("got %+v, want allowed with %d remaining", res, i)
+		}
+	}
+	res := l.Allow("a", limit)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Errorf("got %+v when empty", res)
+	}
+	if res := l.Allow("b", limit); !res.Allowed {
+		t.Errorf("another key was limited: %+v", res)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if res := l.Allow("a", limit); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("got %+v after a token was added", res)
+	}
+
+	if res := l.Allow("a", ratelimit.Limit{}); !res.Allowed {
+		t.Errorf("got %+v without a limit", res)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := ratelimit.NewWithClock(func() time.Time { return now })
+	slow := ratelimit.Limit{Rate: 0.001, Burst: 1}
+	l.Allow("idle", ratelimit.Limit{Rate: 1, Burst: 1})
+	l.Allow("busy", slow)
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("busy", slow)
+	if l.Len() != 1 {
+		t.Errorf("got %d buckets, want the refilled one dropped", l.Len())
+	}
+}
@@ -0,0 +1,88 @@
+// Package tlscert serves a certificate from files, loaded again when they
+// change, so that a renewed certificate is used without a restart.
+package tlscert
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader loads a certificate and its key for tls.Config.GetCertificate.
+// Handshakes check the files for changes, at most once per interval. A
+// certificate that fails to load is reported to onError, and the previous
+// one is kept.
+type Reloader struct {
+	certFile, keyFile string
+	every             time.Duration
+	onError           func(error)
+	now               func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamp   string
+	checked time.Time
+}
+
+func NewReloader(certFile, keyFile string, every time.Duration, onError func(error)) (*Reloader, error) {
+	return NewReloaderWithClock(certFile, keyFile, every, onError, time.Now)
+}
+
+// NewReloaderWithClock is NewReloader with another clock, for tests.
+func NewReloaderWithClock(certFile, keyFile string, every time.Duration, onError func(error),
+	now func() time.Time) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, every: every, onError: onError, now: now}
+	stamp, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.load(stamp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// stat tells the files apart from a previous version by size and time.
+func (r *Reloader) stat() (string, error) {
+	var stamp string
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+func (r *Reloader) load(stamp string) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert, r.stamp, r.checked = &cert, stamp, r.now()
+	return nil
+}
+
+// GetCertificate returns the certificate, loaded again if the files
+// changed.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.now().Sub(r.checked) < r.every {
+		return r.cert, nil
+	}
+	r.checked = r.now()
+
+	stamp, err := r.stat()
+	if err == nil && stamp != r.stamp {
+		err = r.load(stamp)
+	}
+	if err != nil && r.onError != nil {
+		r.onError(fmt.Errorf("reload certificate %s: %w", r.certFile, err))
+	}
+	return r.cert, nil
+}
@@ -0,0 +1,101 @@
+package tlscert_test
+
+import (
+	"crud/pkg/tlscert"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name and its key.
+func writeCert(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err = os.WriteFile(certFile, certPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, keyPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, r *tlscert.Reloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "first")
+
+	now := time.Unix(0, 0)
+	var errs []error
+	r, err := tlscert.NewReloaderWithClock(certFile, keyFile, time.Minute,
+		func(err error) { errs = append(errs, err) }, func() time.Time { return now })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert(t, certFile, keyFile, "second")
+	// The files may keep their modification time on a coarse clock.
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	if got := commonName(t, r); got != "first" {
+		t.Errorf("got %s before the interval, want first", got)
+	}
+	now = now.Add(time.Minute)
+	if got := commonName(t, r); got != "second" {
+		t.Errorf("got %s after the files changed, want second", got)
+	}
+
+	if err = os.WriteFile(keyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if got := commonName(t, r); got != "second" || len(errs) != 1 {
+		t.Errorf("got %s and errors %v, want the previous certificate kept and the error reported", got, errs)
+	}
+}
+
+func TestReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := tlscert.NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), time.Minute, nil); err == nil {
+		t.Error("missing files were accepted")
+	}
+}
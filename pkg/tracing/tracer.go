@@ -0,0 +1,288 @@
+package tracing
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Kind int
+
+// Span kinds, numbered as in OTLP.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// SpanData is a finished span as exporters receive it.
+type SpanData struct {
+	Service      string
+	Name         string
+	Kind         Kind
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	// Error is the message of the error the span ended with, if any.
+	Error string
+}
+
+// Exporter sends finished spans somewhere. The Tracer calls it from a single
+// goroutine.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+)
+
+// Tracer starts spans and hands the sampled ones to its exporter in
+// batches. Spans are dropped when the exporter can't keep up.
+type Tracer struct {
+	service     string
+	exporter    Exporter
+	sampleRatio float64
+	onError     func(error)
+
+	queue chan SpanData
+	flush chan chan struct{}
+	done  chan struct{}
+	// mu guards closing the queue against sending to it.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewTracer returns a tracer exporting to exporter, which may be nil to only
+// propagate trace ids. Traces started here are sampled with sampleRatio,
+// others follow the decision of the caller. onError reports export failures.
+func NewTracer(service string, exporter Exporter, sampleRatio float64, onError func(error)) *Tracer {
+	t := &Tracer{
+		service:     service,
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+		onError:     onError,
+		queue:       make(chan SpanData, queueSize),
+		flush:       make(chan chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if exporter != nil {
+		go t.run()
+	} else {
+		close(t.done)
+	}
+	return t
+}
+
+// Start starts a span as a child of the span in ctx, or of the remote parent
+// set with WithRemoteParent, or as the root of a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := FromContext(ctx)
+
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.State = parent.State
+	} else {
+		sc.TraceID = newTraceID()
+		if t.sampleRatio >= 1 || rand.Float64() < t.sampleRatio {
+			sc.Flags = flagSampled
+		}
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Service:      t.service,
+			Name:         name,
+			Kind:         kind,
+			TraceID:      sc.TraceID,
+			SpanID:       sc.SpanID,
+			ParentSpanID: parent.SpanID,
+			Start:        time.Now(),
+		},
+		sc: sc,
+	}
+
+	return context.WithValue(ctx, contextKey{}, spanRef{span: span, sc: sc}), span
+}
+
+func (t *Tracer) export(data SpanData) {
+	if t.exporter == nil {
+		return
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), flushInterval)
+		defer cancel()
+		if err := t.exporter.Export(ctx, batch); err != nil && t.onError != nil {
+			t.onError(err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				send()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-t.flush:
+			// Take what is queued so far, without waiting for more.
+			for n := len(t.queue); n > 0; n-- {
+				data, ok := <-t.queue
+				if !ok {
+					break
+				}
+				batch = append(batch, data)
+			}
+			send()
+			close(flushed)
+		}
+	}
+}
+
+// Flush exports the spans ended so far.
+func (t *Tracer) Flush(ctx context.Context) {
+	if t.exporter == nil {
+		return
+	}
+	flushed := make(chan struct{})
+	select {
+	case t.flush <- flushed:
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+		}
+	case <-t.done:
+	case <-ctx.Done():
+	}
+}
+
+// Shutdown exports the remaining spans and stops the exporter. Spans ended
+// afterwards are lost.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// Span is an operation being traced. Its methods are safe for concurrent
+// use and do nothing after End.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// SetAttr records a string, bool, integer or float attribute.
+func (s *Span) SetAttr(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetError marks the span as failed. A nil err does nothing.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended {
+		s.data.Error = err.Error()
+	}
+}
+
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sc.Sampled() {
+		s.tracer.export(data)
+	}
+}
@@ -0,0 +1,190 @@
+// Package tracing creates spans and propagates them with the W3C Trace
+// Context headers, traceparent and tracestate. Finished spans go to a
+// pluggable Exporter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// flagSampled is the only trace flag defined by the W3C spec.
+const flagSampled = 0x01
+
+// maxTracestate is the length above which the spec lets tracestate be
+// dropped.
+const maxTracestate = 512
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func newTraceID() (id TraceID) {
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	rand.Read(id[:])
+	return id
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// State is the tracestate header, passed along untouched.
+	State string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// Traceparent formats sc as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// MarshalZerologObject adds the trace and span ids to a log line, so that
+// logs can be joined with traces. An invalid SpanContext adds nothing.
+func (sc SpanContext) MarshalZerologObject(e *zerolog.Event) {
+	if !sc.IsValid() {
+		return
+	}
+	e.Str("trace_id", sc.TraceID.String()).Str("span_id", sc.SpanID.String())
+}
+
+var ErrTraceparent = errors.New("malformed traceparent")
+
+// ParseTraceparent parses a traceparent header. Versions above 00 are read
+// as 00, as the spec asks, as long as they start the same way.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 {
+		return sc, ErrTraceparent
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	switch {
+	case len(version) != 2 || !isLowerHex(version) || version == "ff":
+		return sc, ErrTraceparent
+	case version == "00" && len(parts) != 4:
+		return sc, ErrTraceparent
+	case len(traceID) != 32 || !isLowerHex(traceID),
+		len(spanID) != 16 || !isLowerHex(spanID),
+		len(flags) != 2 || !isLowerHex(flags):
+		return sc, ErrTraceparent
+	}
+
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrTraceparent
+	}
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract reads the span context of the caller from request headers. It
+// returns an invalid SpanContext if there is none or it is malformed.
+func Extract(h http.Header) SpanContext {
+	sc, err := ParseTraceparent(strings.TrimSpace(h.Get(TraceparentHeader)))
+	if err != nil {
+		return SpanContext{}
+	}
+
+	state := strings.Join(h.Values(TracestateHeader), ",")
+	if len(state) <= maxTracestate {
+		sc.State = state
+	}
+	return sc
+}
+
+// Inject writes the span context in ctx into outgoing headers.
+func Inject(ctx context.Context, h http.Header) {
+	sc := FromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.State != "" {
+		h.Set(TracestateHeader, sc.State)
+	}
+}
+
+type contextKey struct{}
+
+// spanRef is what a context carries: the current span, or only the span
+// context of a remote parent.
+type spanRef struct {
+	span *Span
+	sc   SpanContext
+}
+
+// FromContext returns the span context of the current span of ctx.
+func FromContext(ctx context.Context) SpanContext {
+	ref, _ := ctx.Value(contextKey{}).(spanRef)
+	return ref.sc
+}
+
+// SpanFromContext returns the current span of ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	ref, _ := ctx.Value(contextKey{}).(spanRef)
+	return ref.span
+}
+
+// WithRemoteParent makes sc, usually from Extract, the parent of the next
+// span started from the returned context.
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, spanRef{sc: sc})
+}
@@ -0,0 +1,136 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"crud/pkg/tracing"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := tracing.ParseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" ||
+		!sc.Sampled() {
+		t.Errorf("parsed %+v", sc)
+	}
+	if sc.Traceparent() != valid {
+		t.Errorf("formatted %s, want %s", sc.Traceparent(), valid)
+	}
+
+	// A future version may append fields.
+	if _, err = tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Errorf("future version: %v", err)
+	}
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, err = tracing.ParseTraceparent(s); !errors.Is(err, tracing.ErrTraceparent) {
+			t.Errorf("%q: got %v, want ErrTraceparent", s, err)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	tracer := tracing.NewTracer("test", nil, 1, nil)
+
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	in.Set("tracestate", "vendor=value")
+
+	ctx := tracing.WithRemoteParent(context.Background(), tracing.Extract(in))
+	ctx, span := tracer.Start(ctx, "server", tracing.KindServer)
+	defer span.End()
+
+	out := http.Header{}
+	tracing.Inject(ctx, out)
+
+	sc, err := tracing.ParseTraceparent(out.Get("traceparent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id %s was not kept", sc.TraceID)
+	}
+	if sc.SpanID.String() == "00f067aa0ba902b7" || sc.SpanID != span.SpanContext().SpanID {
+		t.Errorf("span id %s is not the new span's", sc.SpanID)
+	}
+	if sc.Sampled() {
+		t.Error("the caller's unsampled decision was overridden")
+	}
+	if out.Get("tracestate") != "vendor=value" {
+		t.Errorf("tracestate %q was not kept", out.Get("tracestate"))
+	}
+}
+
+func TestExport(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer("test", tracing.NewWriterExporter(&buf), 1, nil)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", tracing.KindServer)
+	_, child := tracer.Start(ctx, "child", tracing.KindClient)
+	child.SetAttr("api", "Get")
+	child.SetError(errors.New("not found"))
+	child.End()
+	parent.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var spans []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var span map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &span); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+
+	c, p := spans[0], spans[1]
+	if c["name"] != "child" || c["kind"] != "client" || c["error"] != "not found" {
+		t.Errorf("child %v", c)
+	}
+	if c["trace_id"] != p["trace_id"] || c["parent_span_id"] != p["span_id"] {
+		t.Errorf("child %v is not under parent %v", c, p)
+	}
+	if _, ok := p["parent_span_id"]; ok {
+		t.Errorf("root span %v has a parent", p)
+	}
+
+	// Spans ended after Shutdown are dropped.
+	_, late := tracer.Start(context.Background(), "late", tracing.KindInternal)
+	late.End()
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer("test", tracing.NewWriterExporter(&buf), 0, nil)
+
+	_, span := tracer.Start(context.Background(), "unsampled", tracing.KindInternal)
+	span.End()
+	tracer.Shutdown(context.Background())
+
+	if buf.Len() != 0 {
+		t.Errorf("exported an unsampled span: %s", buf.String())
+	}
+}
@@ -0,0 +1,210 @@
+// Package validate checks structs against rules declared in `validate` tags:
+//
+//	Name      string    `json:"name" validate:"required,max=200"`
+//	CreatedAt time.Time `json:"created_at" validate:"default=now,min=2000-01-01T00:00:00Z,max=now+1h"`
+//
+// Rules:
+//   - required: strings must not be blank, numbers and times must not be zero;
+//   - min, max: bounds on the length of strings (in characters), on numbers
+//     and on times. Time bounds are RFC 3339 timestamps or "now" with an
+//     optional signed duration, e.g. "now-24h";
+//   - default=now: sets a zero time to the current time before the other
+//     rules run.
+//
+// Pointer fields are checked only when they are set, which suits partial
+// updates where a nil field means "leave as is".
+//
+// Fields are reported by their json name.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const tagName = "validate"
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors lists every field that broke a rule.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Struct applies defaults to and validates the struct v points to. It returns
+// Errors if any rule is broken.
+func Struct(v interface{}) error {
+	now := time.Now()
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: expected a pointer to a struct, got %T", v))
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	var errs Errors
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, ok := sf.Tag.Lookup(tagName)
+		if !ok || tag == "" {
+			continue
+		}
+
+		name := fieldName(sf)
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			key, arg, _ := strings.Cut(rule, "=")
+			fe, ok := check(fv, key, arg, now)
+			if ok {
+				continue
+			}
+			fe.Field = name
+			fe.Rule = rule
+			errs = append(errs, fe)
+			break
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// check applies one rule. It returns false with the message filled in when
+// the value breaks it.
+func check(fv reflect.Value, key, arg string, now time.Time) (FieldError, bool) {
+	if fv.Type() == timeType {
+		return checkTime(fv, key, arg, now)
+	}
+
+	switch key {
+	case "required":
+		if isBlank(fv) {
+			return FieldError{Message: "is required"}, false
+		}
+		return FieldError{}, true
+
+	case "min", "max":
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: incorrect %s bound %q", key, arg))
+		}
+
+		var (
+			n    float64
+			unit string
+		)
+		switch fv.Kind() {
+		case reflect.String:
+			n, unit = float64(utf8.RuneCountInString(fv.String())), " characters"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(fv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = float64(fv.Uint())
+		default:
+			panic(fmt.Sprintf("validate: %s is not supported for %s", key, fv.Type()))
+		}
+
+		if key == "min" && n < bound {
+			return FieldError{Message: fmt.Sprintf("must be at least %s%s", arg, unit)}, false
+		}
+		if key == "max" && n > bound {
+			return FieldError{Message: fmt.Sprintf("must be at most %s%s", arg, unit)}, false
+		}
+		return FieldError{}, true
+	}
+
+	panic(fmt.Sprintf("validate: unknown rule %q for %s", key, fv.Type()))
+}
+
+func checkTime(fv reflect.Value, key, arg string, now time.Time) (FieldError, bool) {
+	t := fv.Interface().(time.Time)
+
+	switch key {
+	case "default":
+		if arg != "now" {
+			panic(fmt.Sprintf("validate: unknown time default %q", arg))
+		}
+		if t.IsZero() && fv.CanSet() {
+			fv.Set(reflect.ValueOf(now.UTC()))
+		}
+		return FieldError{}, true
+
+	case "required":
+		if t.IsZero() {
+			return FieldError{Message: "is required"}, false
+		}
+		return FieldError{}, true
+
+	case "min", "max":
+		bound := parseTimeBound(arg, now)
+		if key == "min" && t.Before(bound) {
+			return FieldError{Message: "must not be before " + bound.Format(time.RFC3339)}, false
+		}
+		if key == "max" && t.After(bound) {
+			return FieldError{Message: "must not be after " + bound.Format(time.RFC3339)}, false
+		}
+		return FieldError{}, true
+	}
+
+	panic(fmt.Sprintf("validate: unknown rule %q for time", key))
+}
+
+func parseTimeBound(arg string, now time.Time) time.Time {
+	if strings.HasPrefix(arg, "now") {
+		rest := strings.TrimPrefix(arg, "now")
+		if rest == "" {
+			return now
+		}
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			panic(fmt.Sprintf("validate: incorrect time bound %q", arg))
+		}
+		return now.Add(d)
+	}
+
+	t, err := time.Parse(time.RFC3339, arg)
+	if err != nil {
+		panic(fmt.Sprintf("validate: incorrect time bound %q", arg))
+	}
+	return t
+}
+
+func isBlank(fv reflect.Value) bool {
+	if fv.Kind() == reflect.String {
+		return strings.TrimSpace(fv.String()) == ""
+	}
+	return fv.IsZero()
+}
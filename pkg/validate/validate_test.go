@@ -0,0 +1,163 @@
+package validate_test
+
+import (
+	"crud/pkg/validate"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type post struct {
+	Title     string    `json:"title" validate:"required,max=5"`
+	Likes     int       `json:"likes,omitempty" validate:"min=-1,max=10"`
+	Views     uint      `validate:"min=1"`
+	CreatedAt time.Time `json:"created_at" validate:"default=now,min=2000-01-01T00:00:00Z,max=now+1h"`
+	Note      string    `json:"note"`
+}
+
+type patch struct {
+	Title     *string    `json:"title" validate:"required,max=5"`
+	CreatedAt *time.Time `json:"created_at" validate:"required,min=2000-01-01T00:00:00Z"`
+}
+
+func fieldErrors(t *testing.T, err error) validate.Errors {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var fieldErrs validate.Errors
+	if !errors.As(err, &fieldErrs) {
+		t.Fatalf("got %T %v, want validate.Errors", err, err)
+	}
+	return fieldErrs
+}
+
+func TestStruct(t *testing.T) {
+	valid := post{Title: "hi", Views: 1, CreatedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	for _, c := range []struct {
+		name   string
+		change func(*post)
+		want   validate.Errors
+	}{
+		{"valid", func(*post) {}, nil},
+		{"blank", func(p *post) { p.Title = "  " },
+			validate.Errors{{Field: "title", Rule: "required", Message: "is required"}}},
+		{"max counts characters", func(p *post) { p.Title = "héllo" }, nil},
+		{"too long", func(p *post) { p.Title = "hello!" },
+			validate.Errors{{Field: "title", Rule: "max=5", Message: "must be at most 5 characters"}}},
+		{"int below min", func(p *post) { p.Likes = -2 },
+			validate.Errors{{Field: "likes", Rule: "min=-1", Message: "must be at least -1"}}},
+		{"int above max", func(p *post) { p.Likes = 11 },
+			validate.Errors{{Field: "likes", Rule: "max=10", Message: "must be at most 10"}}},
+		{"go name without a json tag", func(p *post) { p.Views = 0 },
+			validate.Errors{{Field: "Views", Rule: "min=1", Message: "must be at least 1"}}},
+		{"time before min", func(p *post) { p.CreatedAt = time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC) },
+			validate.Errors{{Field: "created_at", Rule: "min=2000-01-01T00:00:00Z", Message: "must not be before 2000-01-01T00:00:00Z"}}},
+		{"every field is reported", func(p *post) { p.Title, p.Likes = "", 11 },
+			validate.Errors{
+				{Field: "title", Rule: "required", Message: "is required"},
+				{Field: "likes", Rule: "max=10", Message: "must be at most 10"},
+			}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := valid
+			c.change(&p)
+			if got := fieldErrors(t, validate.Struct(&p)); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStructRelativeTime(t *testing.T) {
+	p := post{Title: "hi", Views: 1, CreatedAt: time.Now().Add(2 * time.Hour)}
+	got := fieldErrors(t, validate.Struct(&p))
+	if len(got) != 1 || got[0].Field != "created_at" || got[0].Rule != "max=now+1h" ||
+		!strings.HasPrefix(got[0].Message, "must not be after ") {
+		t.Errorf("got %#v, want created_at after now+1h", got)
+	}
+
+	p.CreatedAt = time.Now().Add(30 * time.Minute)
+	if err := validate.Struct(&p); err != nil {
+		t.Errorf("got %v within the bound", err)
+	}
+}
+
+func TestStructDefaultNow(t *testing.T) {
+	before := time.Now()
+	p := post{Title: "hi", Views: 1}
+	if err := validate.Struct(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.CreatedAt.Before(before.Add(-time.Second)) || p.CreatedAt.After(time.Now()) ||
+		p.CreatedAt.Location() != time.UTC {
+		t.Errorf("got %v, want the current time in UTC", p.CreatedAt)
+	}
+
+	set := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.CreatedAt = set
+	if err := validate.Struct(&p); err != nil || !p.CreatedAt.Equal(set) {
+		t.Errorf("got %v and %v, want a set time kept", p.CreatedAt, err)
+	}
+}
+
+func TestStructPointers(t *testing.T) {
+	if err := validate.Struct(&patch{}); err != nil {
+		t.Errorf("got %v, want nil fields skipped", err)
+	}
+
+	blank, long, old := "", "hello!", time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := fieldErrors(t, validate.Struct(&patch{Title: &blank, CreatedAt: &old}))
+	want := validate.Errors{
+		{Field: "title", Rule: "required", Message: "is required"},
+		{Field: "created_at", Rule: "min=2000-01-01T00:00:00Z", Message: "must not be before 2000-01-01T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	got = fieldErrors(t, validate.Struct(&patch{Title: &long}))
+	if len(got) != 1 || got[0].Rule != "max=5" {
+		t.Errorf("got %#v, want title too long", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	err := validate.Errors{
+		{Field: "title", Rule: "required", Message: "is required"},
+		{Field: "likes", Rule: "max=10", Message: "must be at most 10"},
+	}
+	if got := err.Error(); got != "title: is required; likes: must be at most 10" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStructMisuse(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"not a pointer", post{}},
+		{"unknown rule", &struct {
+			A string `validate:"email"`
+		}{A: "a"}},
+		{"bad bound", &struct {
+			A string `validate:"max=ten"`
+		}{}},
+		{"bad time bound", &struct {
+			A time.Time `validate:"max=tomorrow"`
+		}{}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			validate.Struct(c.v)
+		})
+	}
+}